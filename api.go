@@ -1,42 +1,123 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"command-encoding-service/pkg/generate_codes"
 )
 
+// ServerConfig configures the http.Server, 0 means no timeout
+type ServerConfig struct {
+	ReadTimeout    time.Duration // reading the whole request, including the body
+	WriteTimeout   time.Duration // from the end of the request headers to the end of the response
+	IdleTimeout    time.Duration // keep-alive connections waiting for the next request
+	MaxHeaderBytes int
+	// how long Run waits for in-flight requests to finish before closing their connections
+	ShutdownTimeout time.Duration
+}
+
 type simpleAPIServer struct {
 	listenAddress string
+	config        ServerConfig
 	storage       Storage
+	// algorithm of codes without a length limit (AlgorithmHuffman or AlgorithmCanonical)
+	algorithm generate_codes.Algorithm
+	// default limit of the code length, used when a command log doesn't set its own, 0 - no limit
+	maxCodeLength int
+	// only one goroutine generates codes for a command log, the others wait for its result
+	codeGeneration *singleFlight[int, []CommandCodeRequest]
 }
 
-type APIError struct {
-	Error string
+func NewApiServer(listenAddress string, config ServerConfig, storage Storage, algorithm generate_codes.Algorithm, maxCodeLength int) *simpleAPIServer {
+	return &simpleAPIServer{
+		listenAddress:  listenAddress,
+		config:         config,
+		storage:        storage,
+		algorithm:      algorithm,
+		maxCodeLength:  maxCodeLength,
+		codeGeneration: newSingleFlight[int, []CommandCodeRequest](),
+	}
 }
 
-func NewApiServer(listenAddress string, storage Storage) *simpleAPIServer {
-	return &simpleAPIServer{
-		listenAddress: listenAddress,
-		storage:       storage,
+// Run serves the API until ctx is canceled, then stops accepting new connections
+// and waits up to ShutdownTimeout for in-flight requests.
+// It returns nil after a graceful shutdown and the error if the server can't start or drain in time.
+func (s *simpleAPIServer) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:           s.listenAddress,
+		Handler:        requestIDMiddleware(accessLogMiddleware(s.router())),
+		ReadTimeout:    s.config.ReadTimeout,
+		WriteTimeout:   s.config.WriteTimeout,
+		IdleTimeout:    s.config.IdleTimeout,
+		MaxHeaderBytes: s.config.MaxHeaderBytes,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("JSON API server running", "address", s.listenAddress)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// the server stopped by itself, e.g. the port is already in use
+		return err
+	case <-ctx.Done():
 	}
+
+	slog.Info("Shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := withTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// not drained in time - cut off the remaining requests
+		server.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-func (s *simpleAPIServer) Run() {
+func (s *simpleAPIServer) router() http.Handler {
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
 
 	router.HandleFunc("/commands", makeHTTPHandlerFunc(s.handleCommands))
-	router.HandleFunc("/rcr/{command}", makeHTTPHandlerFunc(s.handleGetCodeForCommandFromLastCommandLog))
+	router.HandleFunc("/commands/{id:[0-9]+}", makeHTTPHandlerFunc(s.handleGetCommandLog)).Methods("GET")
+	router.HandleFunc("/commands/{id:[0-9]+}/codes", makeHTTPHandlerFunc(s.handleGetCodesForCommandLog)).Methods("GET")
+	router.HandleFunc("/commands/{id:[0-9]+}/tree", makeHTTPHandlerFunc(s.handleGetTree)).Methods("GET")
+	router.HandleFunc("/commands/{id:[0-9]+}/stats", makeHTTPHandlerFunc(s.handleGetStats)).Methods("GET")
+	router.HandleFunc("/commands/{id:[0-9]+}/codebook", makeHTTPHandlerFunc(s.handleGetCodebook)).Methods("GET")
+	router.HandleFunc("/commands/{id:[0-9]+}/rcr/{command}", makeHTTPHandlerFunc(s.handleGetCodeForCommand)).Methods("GET")
+	router.HandleFunc("/rcr/{command}", makeHTTPHandlerFunc(s.handleGetCodeForCommand))
 	router.HandleFunc("/allCommandCodes", makeHTTPHandlerFunc(s.handleGetAllCommandCodes))
-
-	log.Println("JSON API server running on port: ", s.listenAddress)
-	http.ListenAndServe(s.listenAddress, router)
+	router.HandleFunc("/codes/from-frequencies", makeHTTPHandlerFunc(s.handleCodesFromFrequencies)).Methods("POST")
+	router.HandleFunc("/encode", makeHTTPHandlerFunc(s.handleEncode)).Methods("POST")
+	router.HandleFunc("/decode", makeHTTPHandlerFunc(s.handleDecode)).Methods("POST")
+	router.HandleFunc("/healthz", makeHTTPHandlerFunc(s.handleHealthz)).Methods("GET")
+	router.HandleFunc("/readyz", makeHTTPHandlerFunc(s.handleReadyz)).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.Use(metricsMiddleware)
+
+	return router
 }
 
 func writeJson(w http.ResponseWriter, status int, v any) error {
@@ -46,43 +127,66 @@ func writeJson(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+func writeText(w http.ResponseWriter, status int, contentType string, text string) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+
+	_, err := io.WriteString(w, text)
+	return err
+}
+
 type apiHandlerFunc func(w http.ResponseWriter, r *http.Request) error
 
 func makeHTTPHandlerFunc(apiHandlerFunc apiHandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := apiHandlerFunc(w, r); err != nil {
 			// error handling
-			writeJson(w, http.StatusBadRequest, APIError{Error: err.Error()})
+			apiErr := toAPIError(err)
+			logInternalError(r, apiErr)
+			writeAPIError(w, apiErr)
 		}
 	}
 }
 
 func (s *simpleAPIServer) handleCommands(w http.ResponseWriter, r *http.Request) error {
 	if r.Method == "GET" {
-		return s.handleGetAllCommandLogs(w)
+		return s.handleGetAllCommandLogs(w, r)
 	}
 	if r.Method == "POST" {
 		return s.handlePostCommands(w, r)
 	}
 
-	return fmt.Errorf("request method not allowed: %s", r.Method)
+	return newMethodNotAllowedError(r.Method)
 }
 
-func (s *simpleAPIServer) handleGetCodeForCommandFromLastCommandLog(w http.ResponseWriter, r *http.Request) error {
+// getCommandLogID returns the command log id from the path (/commands/{id}/...)
+// or from the ?log= parameter, 0 means the latest command log
+func getCommandLogID(r *http.Request) (int, error) {
+	idStr, ok := mux.Vars(r)["id"]
+	if !ok {
+		idStr = r.URL.Query().Get("log")
+	}
+	if idStr == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id < 1 {
+		return 0, NewBadRequestError(CodeValidationFailed, fmt.Errorf("invalid command log id: %s", idStr))
+	}
+	return id, nil
+}
+
+func (s *simpleAPIServer) handleGetCodeForCommand(w http.ResponseWriter, r *http.Request) error {
 	command := mux.Vars(r)["command"]
+	commandLogID, err := getCommandLogID(r)
+	if err != nil {
+		return err
+	}
 
 	// get code from DB or memory and send code
-	code, err := getCodeForCommandFromLastCommandLog(command, s.storage)
+	code, err := s.getCodeForCommandFromCommandLog(r.Context(), command, commandLogID)
 	if err != nil {
-		// Check if the error is due to the command not being found
-		if errors.Is(err, ErrCommandNotFound) {
-			// Return a 404 Not Found response
-			http.Error(w, "Command not found", http.StatusNotFound)
-			return nil
-		}
-
-		// Handle other errors
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return err
 	}
 
@@ -93,11 +197,15 @@ func (s *simpleAPIServer) handleGetCodeForCommandFromLastCommandLog(w http.Respo
 
 func (s *simpleAPIServer) handlePostCommands(w http.ResponseWriter, r *http.Request) error {
 	commandsLog := &CommandLog{}
-	if err := json.NewDecoder(r.Body).Decode(commandsLog); err != nil {
+	if err := decodeJSONBody(w, r, commandsLog); err != nil {
+		return err
+	}
+
+	if err := validateCommandLog(commandsLog); err != nil {
 		return err
 	}
 
-	commandsLogWithTimestamp, err := s.storage.SetCommandLog(commandsLog)
+	commandsLogWithTimestamp, err := s.storage.SetCommandLog(r.Context(), commandsLog)
 	if err != nil {
 		return err
 	}
@@ -105,47 +213,304 @@ func (s *simpleAPIServer) handlePostCommands(w http.ResponseWriter, r *http.Requ
 	return writeJson(w, http.StatusOK, commandsLogWithTimestamp)
 }
 
-func (s *simpleAPIServer) handleGetAllCommandLogs(w http.ResponseWriter) error { //, r *http.Request) error {
-	// Call the storage method to get all command logs
-	commandLogs, err := s.storage.GetAllCommandLogs()
+func (s *simpleAPIServer) handleGetAllCommandLogs(w http.ResponseWriter, r *http.Request) error {
+	filter, err := parseCommandLogFilter(r)
+	if err != nil {
+		return err
+	}
+
+	// Call the storage method to get one page of command logs
+	commandLogs, err := s.storage.ListCommandLogs(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	page := nextPage(w, commandLogs, filter.Limit, func(commandLog *CommandLogRequest) int { return commandLog.ID })
+	return writeJson(w, http.StatusOK, page)
+}
+
+func (s *simpleAPIServer) handleGetCommandLog(w http.ResponseWriter, r *http.Request) error {
+	commandLogID, err := getCommandLogID(r)
 	if err != nil {
 		return err
 	}
 
-	return writeJson(w, http.StatusOK, commandLogs)
+	commandLog, err := s.storage.GetCommandLog(r.Context(), commandLogID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCommandLogNotFound
+		}
+		return err
+	}
+
+	return writeJson(w, http.StatusOK, commandLog)
+}
+
+func (s *simpleAPIServer) handleGetCodesForCommandLog(w http.ResponseWriter, r *http.Request) error {
+	commandLogID, err := getCommandLogID(r)
+	if err != nil {
+		return err
+	}
+
+	_, commandCodes, err := s.getCodesForCommandLogID(r.Context(), commandLogID)
+	if err != nil {
+		return err
+	}
+
+	return writeJson(w, http.StatusOK, commandCodes)
 }
 
 func (s *simpleAPIServer) handleGetAllCommandCodes(w http.ResponseWriter, r *http.Request) error {
-	allCommandCodes, err := s.storage.GetAllCommandCodes()
+	filter, err := parseCommandCodeFilter(r)
 	if err != nil {
 		return err
 	}
 
-	return writeJson(w, http.StatusOK, allCommandCodes)
+	commandCodes, err := s.storage.ListCommandCodes(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	page := nextPage(w, commandCodes, filter.Limit, func(code CommandCodeRequest) int { return code.ID })
+	return writeJson(w, http.StatusOK, page)
 }
 
-// Define a custom error type for command not found
-var ErrCommandNotFound = errors.New("command not found")
+// handleCodesFromFrequencies generates codes for the given frequencies, nothing is stored
+func (s *simpleAPIServer) handleCodesFromFrequencies(w http.ResponseWriter, r *http.Request) error {
+	request := &CodesFromFrequenciesRequest{}
+	if err := decodeJSONBody(w, r, request); err != nil {
+		return err
+	}
+
+	if err := validateCodesFromFrequencies(request); err != nil {
+		return err
+	}
 
-func getCodeForCommandFromLastCommandLog(command string, db Storage) (string, error) {
-	commandLog, err := db.GetLatestCommandLog()
+	maxCodeLength := request.MaxCodeLength
+	if maxCodeLength == 0 {
+		maxCodeLength = s.maxCodeLength
+	}
+	codes, err := generateCodesFromWeights(request.Frequencies, s.algorithm, maxCodeLength)
 	if err != nil {
-		return "", err
+		return err
 	}
-	//commands := []string{"LEFT", "GRAB", "LEFT", "BACK", "LEFT", "BACK", "LEFT"}
-	comandCodes, err := db.GetCommandCodesForCommandLog(commandLog.ID)
+
+	return writeJson(w, http.StatusOK, CodesFromFrequenciesResponse{Codes: codes, MaxCodeLength: maxCodeLength})
+}
+
+func (s *simpleAPIServer) handleEncode(w http.ResponseWriter, r *http.Request) error {
+	encodeRequest := &EncodeRequest{}
+	if err := decodeJSONBody(w, r, encodeRequest); err != nil {
+		return err
+	}
+
+	commandLog, commandCodes, err := s.getCodesForCommandLogID(r.Context(), encodeRequest.CommandLogID)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	if len(comandCodes) == 0 {
-		// generate codes using command log
-		codeMap := generate_codes.GetCodesFromListOfCommands(commandLog.Commands)
-		codes := ConvertCodesToCommandCodeSlice(codeMap)
-		comandCodes, err = db.SetCommandCodes(codes, commandLog.ID)
-		if err != nil {
-			return "", err
+	data, bitLength, err := generate_codes.EncodeCommands(encodeRequest.Commands, ConvertCommandCodesToMap(commandCodes))
+	if err != nil {
+		return err
+	}
+
+	encodeResponse := EncodeResponse{
+		CommandLogID: commandLog.ID,
+		Data:         base64.StdEncoding.EncodeToString(data),
+		BitLength:    bitLength,
+		Bits:         generate_codes.FormatBits(data, bitLength),
+	}
+	return writeJson(w, http.StatusOK, encodeResponse)
+}
+
+func (s *simpleAPIServer) handleDecode(w http.ResponseWriter, r *http.Request) error {
+	decodeRequest := &DecodeRequest{}
+	if err := decodeJSONBody(w, r, decodeRequest); err != nil {
+		return err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(decodeRequest.Data)
+	if err != nil {
+		return err
+	}
+
+	commandLog, commandCodes, err := s.getCodesForCommandLogID(r.Context(), decodeRequest.CommandLogID)
+	if err != nil {
+		return err
+	}
+	codebook := ConvertCommandCodesToMap(commandCodes)
+
+	var commands []string
+	switch decodeRequest.Method {
+	case "", "table":
+		commands, err = generate_codes.DecodeCommands(data, decodeRequest.BitLength, codebook)
+	case "tree":
+		root, treeErr := generate_codes.BuildTreeFromCodes(codebook)
+		if treeErr != nil {
+			return treeErr
 		}
+		commands, err = generate_codes.DecodeWithTree(root, data, decodeRequest.BitLength)
+	default:
+		return NewValidationError(CodeValidationFailed, fmt.Errorf("unknown decode method: %s", decodeRequest.Method))
+	}
+	if err != nil {
+		return err
+	}
+
+	decodeResponse := DecodeResponse{
+		CommandLogID: commandLog.ID,
+		Commands:     commands,
+	}
+	return writeJson(w, http.StatusOK, decodeResponse)
+}
+
+// tree formats of /commands/{id}/tree?format=
+const (
+	TreeFormatJSON = "json"
+	TreeFormatDOT  = "dot"
+	TreeFormatText = "text"
+)
+
+// handleGetTree sends the Huffman tree built from the frequencies of the commands in the command log,
+// it shows the merges behind the code lengths, leaves show the served codes
+// (canonical codes have the same lengths, but not the bits of the tree path)
+func (s *simpleAPIServer) handleGetTree(w http.ResponseWriter, r *http.Request) error {
+	commandLogID, err := getCommandLogID(r)
+	if err != nil {
+		return err
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = TreeFormatJSON
+	}
+	if format != TreeFormatJSON && format != TreeFormatDOT && format != TreeFormatText {
+		return NewQueryValidationError([]FieldError{{Field: "format", Message: "must be json, dot or text"}})
+	}
+
+	commandLog, commandCodes, err := s.getCodesForCommandLogID(r.Context(), commandLogID)
+	if err != nil {
+		return err
+	}
+
+	root := generate_codes.GetTreeFromListOfCommands(commandLog.Commands)
+	codes := ConvertCommandCodesToMap(commandCodes)
+	switch format {
+	case TreeFormatDOT:
+		return writeText(w, http.StatusOK, "text/vnd.graphviz", generate_codes.TreeToDOT(root, codes))
+	case TreeFormatText:
+		return writeText(w, http.StatusOK, "text/plain; charset=utf-8", generate_codes.TreeToText(root, codes))
+	}
+	return writeJson(w, http.StatusOK, generate_codes.TreeToJSON(root, codes))
+}
+
+// handleGetStats sends the statistics of the codes of the command log (entropy, average code length, sizes)
+func (s *simpleAPIServer) handleGetStats(w http.ResponseWriter, r *http.Request) error {
+	commandLogID, err := getCommandLogID(r)
+	if err != nil {
+		return err
+	}
+
+	commandLog, commandCodes, err := s.getCodesForCommandLogID(r.Context(), commandLogID)
+	if err != nil {
+		return err
+	}
+
+	stats, err := generate_codes.GetStats(commandLog.Commands, ConvertCommandCodesToMap(commandCodes))
+	if err != nil {
+		return err
+	}
+
+	return writeJson(w, http.StatusOK, stats)
+}
+
+// handleGetCodebook sends the codes of the command log in the binary codebook format (see generate_codes.MarshalCodebook)
+func (s *simpleAPIServer) handleGetCodebook(w http.ResponseWriter, r *http.Request) error {
+	commandLogID, err := getCommandLogID(r)
+	if err != nil {
+		return err
+	}
+
+	commandLog, commandCodes, err := s.getCodesForCommandLogID(r.Context(), commandLogID)
+	if err != nil {
+		return err
+	}
+
+	data, err := generate_codes.MarshalCodebook(NewCodebook(commandCodes))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="codebook-%d.hfcb"`, commandLog.ID))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	return err
+}
+
+// NewCodebook returns the codebook of the stored codes,
+// the algorithm is found from the codes, so codes stored by older versions are described correctly
+func NewCodebook(commandCodes []CommandCodeRequest) generate_codes.Codebook {
+	codebook := generate_codes.Codebook{
+		Algorithm: generate_codes.AlgorithmHuffman,
+		Codes:     ConvertCommandCodesToMap(commandCodes),
+	}
+	if len(commandCodes) > 0 {
+		codebook.MaxCodeLength = commandCodes[0].MaxCodeLength
+	}
+
+	if generate_codes.IsCanonical(codebook.Codes) {
+		codebook.Algorithm = generate_codes.AlgorithmCanonical
+		if codebook.MaxCodeLength > 0 {
+			codebook.Algorithm = generate_codes.AlgorithmLengthLimited
+		}
+	}
+	return codebook
+}
+
+// generateCodes generates codes for the commands, maxCodeLength = 0 means no limit
+// canonical codes are assigned in a fixed order (length, then command),
+// so the codebook can be sent to the robots as a list of (command, length) pairs,
+// length-limited codes are always canonical
+func generateCodes(commands []string, algorithm generate_codes.Algorithm, maxCodeLength int) (map[string]string, error) {
+	if maxCodeLength > 0 {
+		return generate_codes.GetLengthLimitedCodesFromListOfCommands(commands, maxCodeLength)
+	}
+	if algorithm == generate_codes.AlgorithmCanonical {
+		return generate_codes.GetCanonicalCodesFromListOfCommands(commands), nil
+	}
+	return generate_codes.GetCodesFromListOfCommands(commands), nil
+}
+
+// generateCodesFromWeights generates codes for the weights of the commands like generateCodes,
+// maxCodeLength = 0 means no limit
+func generateCodesFromWeights(weights map[string]float64, algorithm generate_codes.Algorithm, maxCodeLength int) (map[string]string, error) {
+	if maxCodeLength > 0 {
+		return generate_codes.GetLengthLimitedCodesFromWeights(weights, maxCodeLength, strings.Compare)
+	}
+	if algorithm == generate_codes.AlgorithmCanonical {
+		return generate_codes.GetCanonicalCodesFromWeights(weights, strings.Compare)
+	}
+	return generate_codes.GetCodesFromWeights(weights, strings.Compare)
+}
+
+func countDistinctCommands(commands []string) int {
+	distinct := make(map[string]struct{}, len(commands))
+	for _, cmd := range commands {
+		distinct[cmd] = struct{}{}
+	}
+	return len(distinct)
+}
+
+// Define a custom error type for command not found
+var ErrCommandNotFound = errors.New("command not found")
+
+// getCodeForCommandFromCommandLog returns the code of the command in the given command log,
+// commandLogID = 0 means the latest command log
+func (s *simpleAPIServer) getCodeForCommandFromCommandLog(ctx context.Context, command string, commandLogID int) (string, error) {
+	_, comandCodes, err := s.getCodesForCommandLogID(ctx, commandLogID)
+	if err != nil {
+		return "", err
 	}
 
 	for _, code := range comandCodes {
@@ -158,10 +523,105 @@ func getCodeForCommandFromLastCommandLog(command string, db Storage) (string, er
 	return "", ErrCommandNotFound
 }
 
-func ConvertCodesToCommandCodeSlice(codes map[string]string) []CommandCode {
+// getCodesForCommandLogID returns the command log and its codes,
+// commandLogID = 0 means the latest command log
+// codes are generated and stored if they don't exist yet
+func (s *simpleAPIServer) getCodesForCommandLogID(ctx context.Context, commandLogID int) (*CommandLogRequest, []CommandCodeRequest, error) {
+	commandLog, err := s.getCommandLog(ctx, commandLogID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comandCodes, err := s.getCodesForCommandLog(ctx, commandLog)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return commandLog, comandCodes, nil
+}
+
+// getCommandLog returns the command log, commandLogID = 0 means the latest command log
+func (s *simpleAPIServer) getCommandLog(ctx context.Context, commandLogID int) (*CommandLogRequest, error) {
+	if commandLogID == 0 {
+		commandLog, err := s.storage.GetLatestCommandLog(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoCommandLogs
+		}
+		return commandLog, err
+	}
+
+	commandLog, err := s.storage.GetCommandLog(ctx, commandLogID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommandLogNotFound
+	}
+	return commandLog, err
+}
+
+// getCodesForCommandLog returns codes of the command log,
+// codes are generated and stored if they don't exist yet
+func (s *simpleAPIServer) getCodesForCommandLog(ctx context.Context, commandLog *CommandLogRequest) ([]CommandCodeRequest, error) {
+	//commands := []string{"LEFT", "GRAB", "LEFT", "BACK", "LEFT", "BACK", "LEFT"}
+	comandCodes, err := s.storage.GetCommandCodesForCommandLog(ctx, commandLog.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(comandCodes) > 0 {
+		codeLookupsTotal.WithLabelValues("cache_hit").Inc()
+		return comandCodes, nil
+	}
+
+	// Codes are generated only once per command log in this process,
+	// concurrent requests for the same log wait for the result.
+	// Other processes (replicas) are handled by the storage - SetCommandCodes
+	// keeps the codes stored first and returns them.
+	// The generation is shared by all waiting requests, so it is not canceled when the first
+	// client goes away - the storage deadlines still apply
+	generationCtx := context.WithoutCancel(ctx)
+	return s.codeGeneration.Do(ctx, commandLog.ID, func() ([]CommandCodeRequest, error) {
+		// the codes could be stored while this goroutine was waiting
+		comandCodes, err := s.storage.GetCommandCodesForCommandLog(generationCtx, commandLog.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(comandCodes) > 0 {
+			codeLookupsTotal.WithLabelValues("cache_hit").Inc()
+			return comandCodes, nil
+		}
+
+		// generate codes using command log
+		maxCodeLength := commandLog.MaxCodeLength
+		if maxCodeLength == 0 {
+			maxCodeLength = s.maxCodeLength
+		}
+		start := time.Now()
+		codeMap, err := generateCodes(commandLog.Commands, s.algorithm, maxCodeLength)
+		codeGenerationDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			codeLookupsTotal.WithLabelValues("failed").Inc()
+			// the log was accepted, but its codes can't be generated with the current settings
+			// (e.g. the default max code length is too small for it)
+			return nil, NewConflictError(err)
+		}
+		codeLookupsTotal.WithLabelValues("generated").Inc()
+		codes := ConvertCodesToCommandCodeSlice(codeMap, maxCodeLength)
+		return s.storage.SetCommandCodes(generationCtx, codes, commandLog.ID)
+	})
+}
+
+func ConvertCodesToCommandCodeSlice(codes map[string]string, maxCodeLength int) []CommandCode {
 	commandCodes := make([]CommandCode, 0, len(codes))
 	for cmd, code := range codes {
-		commandCodes = append(commandCodes, CommandCode{Command: cmd, Code: code})
+		commandCodes = append(commandCodes, CommandCode{Command: cmd, Code: code, MaxCodeLength: maxCodeLength})
 	}
 	return commandCodes
 }
+
+// ConvertCommandCodesToMap returns map/hash table with {key="command", value="code"}
+func ConvertCommandCodesToMap(commandCodes []CommandCodeRequest) map[string]string {
+	codes := make(map[string]string, len(commandCodes))
+	for _, code := range commandCodes {
+		codes[code.Command] = code.CommandCode
+	}
+	return codes
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+// newTestServer returns the router of a server with an empty memory storage and the default settings
+func newTestServer(t *testing.T) (http.Handler, *MemoryStorage) {
+	t.Helper()
+	storage := NewMemoryStorage()
+	server := NewApiServer(":0", ServerConfig{}, storage, generate_codes.AlgorithmHuffman, 0)
+	return server.router(), storage
+}
+
+func doRequest(t *testing.T, handler http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// decodeResponse checks the status and decodes the JSON body
+func decodeResponse[T any](t *testing.T, recorder *httptest.ResponseRecorder, wantStatus int) T {
+	t.Helper()
+	var v T
+	if recorder.Code != wantStatus {
+		t.Fatalf("status %d, want %d, body %s", recorder.Code, wantStatus, recorder.Body)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %s: %v", recorder.Body, err)
+	}
+	return v
+}
+
+func postCommandLog(t *testing.T, handler http.Handler, commands ...string) *CommandLogRequest {
+	t.Helper()
+	body, err := json.Marshal(CommandLog{Commands: commands})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decodeResponse[*CommandLogRequest](t, doRequest(t, handler, "POST", "/commands", string(body)), http.StatusOK)
+}
+
+func TestPostAndGetCommandLog(t *testing.T) {
+	handler, _ := newTestServer(t)
+
+	posted := postCommandLog(t, handler, "LEFT", "GRAB", "LEFT")
+	if posted.ID != 1 || posted.Timestamp.IsZero() || !slices.Equal(posted.Commands, []string{"LEFT", "GRAB", "LEFT"}) {
+		t.Fatalf("POST /commands = %+v", posted)
+	}
+
+	got := decodeResponse[*CommandLogRequest](t, doRequest(t, handler, "GET", "/commands/1", ""), http.StatusOK)
+	if got.ID != posted.ID || !got.Timestamp.Equal(posted.Timestamp) || !slices.Equal(got.Commands, posted.Commands) {
+		t.Fatalf("GET /commands/1 = %+v, want %+v", got, posted)
+	}
+
+	commandLogs := decodeResponse[[]*CommandLogRequest](t, doRequest(t, handler, "GET", "/commands", ""), http.StatusOK)
+	if len(commandLogs) != 1 || commandLogs[0].ID != 1 {
+		t.Fatalf("GET /commands = %+v, want the posted log", commandLogs)
+	}
+}
+
+func TestCodesOfAnyCommandLog(t *testing.T) {
+	handler, storage := newTestServer(t)
+
+	commands := strings.Fields("LEFT LEFT GRAB LEFT BACK BACK LEFT UP RIGHT RIGHT RIGHT DROP LEFT")
+	postCommandLog(t, handler, commands...)
+	postCommandLog(t, handler, "UP", "DOWN", "DOWN")
+
+	wantLatest := map[string]string{"UP": "0", "DOWN": "1"}
+	wantFirst := generate_codes.GetCodesFromListOfCommands(commands)
+	codes := decodeResponse[[]CommandCodeRequest](t, doRequest(t, handler, "GET", "/commands/1/codes", ""), http.StatusOK)
+	if got := ConvertCommandCodesToMap(codes); !maps.Equal(got, wantFirst) {
+		t.Fatalf("GET /commands/1/codes = %v, want %v", got, wantFirst)
+	}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		// the latest log
+		{target: "/rcr/DOWN", want: wantLatest["DOWN"]},
+		{target: "/rcr/UP", want: wantLatest["UP"]},
+		{target: "/rcr/LEFT?log=1", want: wantFirst["LEFT"]},
+		{target: "/commands/1/rcr/DROP", want: wantFirst["DROP"]},
+	}
+	for _, tt := range tests {
+		got := decodeResponse[CommandCodeOnly](t, doRequest(t, handler, "GET", tt.target, ""), http.StatusOK)
+		if got.CommandCode != tt.want {
+			t.Errorf("GET %s = %q, want %q", tt.target, got.CommandCode, tt.want)
+		}
+	}
+
+	// the codes are generated once and stored
+	stored, err := storage.ListCommandCodes(context.Background(), CommandCodeFilter{Limit: 100})
+	if err != nil || len(stored) != len(wantFirst)+2 {
+		t.Fatalf("stored codes = %+v, %v, want %d codes", stored, err, len(wantFirst)+2)
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	handler, _ := newTestServer(t)
+	postCommandLog(t, handler, strings.Fields("LEFT LEFT GRAB LEFT BACK BACK LEFT UP RIGHT")...)
+	postCommandLog(t, handler, "UP", "DOWN")
+
+	message := []string{"GRAB", "LEFT", "UP", "UP", "BACK", "RIGHT"}
+	body, _ := json.Marshal(EncodeRequest{CommandLogID: 1, Commands: message})
+	encoded := decodeResponse[EncodeResponse](t, doRequest(t, handler, "POST", "/encode", string(body)), http.StatusOK)
+	if encoded.CommandLogID != 1 || len(encoded.Bits) != encoded.BitLength {
+		t.Fatalf("POST /encode = %+v", encoded)
+	}
+
+	for _, method := range []string{"", "table", "tree"} {
+		body, _ := json.Marshal(DecodeRequest{CommandLogID: 1, Data: encoded.Data, BitLength: encoded.BitLength, Method: method})
+		decoded := decodeResponse[DecodeResponse](t, doRequest(t, handler, "POST", "/decode", string(body)), http.StatusOK)
+		if decoded.CommandLogID != 1 || !slices.Equal(decoded.Commands, message) {
+			t.Fatalf("POST /decode with method %q = %+v, want %v", method, decoded, message)
+		}
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDB keeps command logs and codes in a single file (embedded bbolt database),
+// for edge deployments where Postgres can't run.
+// Layout:
+//   - CommandLog bucket: key = id (big endian, so keys are sorted by id), value = CommandLogRequest as JSON
+//   - CommandCode bucket: one nested bucket per command log (key = command log id),
+//     inside: key = code id, value = CommandCodeRequest as JSON
+//
+// Deleting the nested bucket of a log works like ON DELETE CASCADE in Postgres.
+// Pages are read with cursors seeked to the page cursor (keys are sorted by id), not by reading all logs.
+// Missing command logs are reported with sql.ErrNoRows, like in SimplePostgresDB.
+// bbolt doesn't support cancellation, so the context is only checked before an operation starts.
+type BoltDB struct {
+	db *bolt.DB
+}
+
+var (
+	commandLogBucket  = []byte("CommandLog")
+	commandCodeBucket = []byte("CommandCode")
+)
+
+func NewBoltDB(path string) (*BoltDB, error) {
+	// the file is locked by the process that has it open - don't wait forever for the lock
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltDB{db: db}, nil
+}
+
+func (db *BoltDB) Init() error {
+	if err := db.createCommandLogBucket(); err != nil {
+		return err
+	}
+
+	if err := db.createCommandCodeBucket(); err != nil {
+		return err
+	}
+
+	return db.deleteEmptyCodes()
+}
+
+// deleteEmptyCodes deletes all codes of logs with the empty code "" - older versions gave it to the only command
+// of a log, it can't be encoded or decoded. The codes are generated again on the next request
+// (like migration 0007 in Postgres).
+func (db *BoltDB) deleteEmptyCodes() error {
+	deleted := 0
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		codesBucket := tx.Bucket(commandCodeBucket)
+
+		var invalidLogs [][]byte
+		err := codesBucket.ForEachBucket(func(commandLogKey []byte) error {
+			cursor := codesBucket.Bucket(commandLogKey).Cursor()
+			for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+				var code CommandCodeRequest
+				if err := json.Unmarshal(value, &code); err != nil {
+					return err
+				}
+				if code.CommandCode == "" {
+					// keys are only valid until the bucket is changed
+					invalidLogs = append(invalidLogs, bytes.Clone(commandLogKey))
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets can't be deleted while iterating over them
+		for _, commandLogKey := range invalidLogs {
+			if err := codesBucket.DeleteBucket(commandLogKey); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Error deleting empty codes from CommandCode bucket", "err", err)
+		return err
+	}
+
+	if deleted > 0 {
+		slog.Info("Deleted codes with an empty code, they are generated again", "commandLogs", deleted)
+	}
+	return nil
+}
+
+// itob returns the key for the id
+func itob(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (db *BoltDB) SetCommandLog(ctx context.Context, commandsLog *CommandLog) (*CommandLogRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	commandsLogWithTimestamp := &CommandLogRequest{
+		ID:            -1,
+		Commands:      commandsLog.Commands,
+		MaxCodeLength: commandsLog.MaxCodeLength,
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(commandLogBucket)
+		// set while the write lock is held, so a log with a higher id is never older (see GetLatestCommandLog)
+		commandsLogWithTimestamp.Timestamp = time.Now().UTC()
+
+		// NextSequence never returns the same value twice, like serial in Postgres
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		commandsLogWithTimestamp.ID = int(id)
+
+		commandLogJSON, err := json.Marshal(commandsLogWithTimestamp)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(itob(commandsLogWithTimestamp.ID), commandLogJSON)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting into CommandLog bucket", "err", err)
+		return nil, err
+	}
+
+	return commandsLogWithTimestamp, nil
+}
+
+// seekPage moves the cursor to the first key of the page - the first key after the page cursor
+// (id of the last item of the previous page, 0 - the first page) in the order
+func seekPage(cursor *bolt.Cursor, after int, order SortOrder) (key []byte, value []byte) {
+	if order == OrderDesc {
+		if after == 0 {
+			return cursor.Last()
+		}
+		// Seek returns the first key >= after, the one before it is the first key < after
+		if key, _ := cursor.Seek(itob(after)); key == nil {
+			return cursor.Last()
+		}
+		return cursor.Prev()
+	}
+	return cursor.Seek(itob(after + 1))
+}
+
+// nextInOrder moves the cursor to the next key in the order
+func nextInOrder(cursor *bolt.Cursor, order SortOrder) (key []byte, value []byte) {
+	if order == OrderDesc {
+		return cursor.Prev()
+	}
+	return cursor.Next()
+}
+
+// readCommandLogs returns all command logs sorted by id
+func readCommandLogs(tx *bolt.Tx) ([]*CommandLogRequest, error) {
+	var commandLogs []*CommandLogRequest
+
+	err := tx.Bucket(commandLogBucket).ForEach(func(_, value []byte) error {
+		var commandLog CommandLogRequest
+		if err := json.Unmarshal(value, &commandLog); err != nil {
+			return err
+		}
+		commandLogs = append(commandLogs, &commandLog)
+		return nil
+	})
+
+	return commandLogs, err
+}
+
+func (db *BoltDB) ListCommandLogs(ctx context.Context, filter CommandLogFilter) ([]*CommandLogRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	commandLogs := []*CommandLogRequest{}
+
+	err := db.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(commandLogBucket).Cursor()
+		for key, value := seekPage(cursor, filter.After, filter.Order); key != nil && len(commandLogs) < filter.Limit; key, value = nextInOrder(cursor, filter.Order) {
+			commandLog := &CommandLogRequest{}
+			if err := json.Unmarshal(value, commandLog); err != nil {
+				return err
+			}
+			if filter.matches(commandLog) {
+				commandLogs = append(commandLogs, commandLog)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading CommandLog bucket", "err", err)
+		return nil, err
+	}
+
+	return commandLogs, nil
+}
+
+// readCommandCodes returns codes of the command log sorted by id
+func readCommandCodes(tx *bolt.Tx, commandLogID int) ([]CommandCodeRequest, error) {
+	var commandCodes []CommandCodeRequest
+
+	logCodes := tx.Bucket(commandCodeBucket).Bucket(itob(commandLogID))
+	if logCodes == nil {
+		return nil, nil
+	}
+
+	err := logCodes.ForEach(func(_, value []byte) error {
+		var cc CommandCodeRequest
+		if err := json.Unmarshal(value, &cc); err != nil {
+			return err
+		}
+		commandCodes = append(commandCodes, cc)
+		return nil
+	})
+
+	return commandCodes, err
+}
+
+// codeCursor is the position in the codes of one command log
+type codeCursor struct {
+	cursor     *bolt.Cursor
+	key, value []byte
+}
+
+// codeCursors merges the codes of all command logs by id, like a k-way merge of sorted lists,
+// the code with the next id in the order is at the top
+type codeCursors struct {
+	cursors []*codeCursor
+	order   SortOrder
+}
+
+func (c *codeCursors) Len() int { return len(c.cursors) }
+func (c *codeCursors) Less(i, j int) bool {
+	if c.order == OrderDesc {
+		return bytes.Compare(c.cursors[i].key, c.cursors[j].key) > 0
+	}
+	return bytes.Compare(c.cursors[i].key, c.cursors[j].key) < 0
+}
+func (c *codeCursors) Swap(i, j int)      { c.cursors[i], c.cursors[j] = c.cursors[j], c.cursors[i] }
+func (c *codeCursors) Push(x interface{}) { c.cursors = append(c.cursors, x.(*codeCursor)) }
+func (c *codeCursors) Pop() interface{} {
+	last := c.cursors[len(c.cursors)-1]
+	c.cursors = c.cursors[:len(c.cursors)-1]
+	return last
+}
+
+func (db *BoltDB) ListCommandCodes(ctx context.Context, filter CommandCodeFilter) ([]CommandCodeRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	commandCodes := []CommandCodeRequest{}
+
+	err := db.db.View(func(tx *bolt.Tx) error {
+		// codes of a log can be stored after codes of a newer log, so the codes of every log are read
+		// from the page cursor on and merged by id
+		merged := &codeCursors{order: filter.Order}
+		addLog := func(logCodes *bolt.Bucket) {
+			if logCodes == nil {
+				return
+			}
+			c := &codeCursor{cursor: logCodes.Cursor()}
+			if c.key, c.value = seekPage(c.cursor, filter.After, filter.Order); c.key != nil {
+				merged.cursors = append(merged.cursors, c)
+			}
+		}
+
+		codesBucket := tx.Bucket(commandCodeBucket)
+		if filter.CommandLogID != 0 {
+			addLog(codesBucket.Bucket(itob(filter.CommandLogID)))
+		} else {
+			err := codesBucket.ForEachBucket(func(commandLogKey []byte) error {
+				addLog(codesBucket.Bucket(commandLogKey))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		heap.Init(merged)
+
+		// timestamps of the logs are read only for the From/To filter
+		logTimestamps := make(map[int]time.Time)
+		logTimestamp := func(commandLogID int) (time.Time, error) {
+			if filter.From.IsZero() && filter.To.IsZero() {
+				return time.Time{}, nil
+			}
+			if timestamp, ok := logTimestamps[commandLogID]; ok {
+				return timestamp, nil
+			}
+			var commandLog CommandLogRequest
+			if err := json.Unmarshal(tx.Bucket(commandLogBucket).Get(itob(commandLogID)), &commandLog); err != nil {
+				return time.Time{}, err
+			}
+			logTimestamps[commandLogID] = commandLog.Timestamp
+			return commandLog.Timestamp, nil
+		}
+
+		for merged.Len() > 0 && len(commandCodes) < filter.Limit {
+			next := merged.cursors[0]
+
+			var code CommandCodeRequest
+			if err := json.Unmarshal(next.value, &code); err != nil {
+				return err
+			}
+			timestamp, err := logTimestamp(code.CommandLogID)
+			if err != nil {
+				return err
+			}
+			if filter.matches(code, timestamp) {
+				commandCodes = append(commandCodes, code)
+			}
+
+			if next.key, next.value = nextInOrder(next.cursor, filter.Order); next.key == nil {
+				heap.Pop(merged)
+			} else {
+				heap.Fix(merged, 0)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading CommandCode bucket", "err", err)
+		return nil, err
+	}
+
+	return commandCodes, nil
+}
+
+func (db *BoltDB) CountCommandLogs(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := db.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(commandLogBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+func (db *BoltDB) GetLatestCommandLog(ctx context.Context) (*CommandLogRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var latest *CommandLogRequest
+
+	// timestamps are set in the order of the ids (see SetCommandLog), so the latest log has the highest id
+	err := db.db.View(func(tx *bolt.Tx) error {
+		key, value := tx.Bucket(commandLogBucket).Cursor().Last()
+		if key == nil {
+			return nil
+		}
+		latest = &CommandLogRequest{}
+		return json.Unmarshal(value, latest)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading CommandLog bucket", "err", err)
+		return nil, err
+	}
+
+	if latest == nil {
+		slog.DebugContext(ctx, "No matching CommandLog found")
+		return nil, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+func (db *BoltDB) GetCommandLog(ctx context.Context, id int) (*CommandLogRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var commandLog *CommandLogRequest
+
+	err := db.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(commandLogBucket).Get(itob(id))
+		if value == nil {
+			return sql.ErrNoRows
+		}
+
+		commandLog = &CommandLogRequest{}
+		return json.Unmarshal(value, commandLog)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commandLog, nil
+}
+
+func (db *BoltDB) GetCommandCodesForCommandLog(ctx context.Context, commandLogID int) ([]CommandCodeRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var commandCodes []CommandCodeRequest
+
+	err := db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		commandCodes, err = readCommandCodes(tx, commandLogID)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading CommandCode bucket", "err", err)
+		return nil, err
+	}
+
+	return commandCodes, nil
+}
+
+func (db *BoltDB) SetCommandCodes(ctx context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var commandCodes []CommandCodeRequest
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		// like the foreign key in CommandCode table
+		if tx.Bucket(commandLogBucket).Get(itob(commandLogID)) == nil {
+			return fmt.Errorf("command log %d does not exist", commandLogID)
+		}
+
+		codesBucket := tx.Bucket(commandCodeBucket)
+		logCodes, err := codesBucket.CreateBucketIfNotExists(itob(commandLogID))
+		if err != nil {
+			return err
+		}
+
+		// like the unique (commandLogID, command) constraint - codes stored first are kept
+		existingCodes, err := readCommandCodes(tx, commandLogID)
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]bool, len(existingCodes))
+		for _, code := range existingCodes {
+			existing[code.Command] = true
+		}
+
+		for _, code := range codes {
+			if existing[code.Command] {
+				continue
+			}
+			existing[code.Command] = true
+
+			// ids are unique in the whole CommandCode bucket, not only in the log
+			id, err := codesBucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			insertedCode := CommandCodeRequest{
+				ID:            int(id),
+				CommandLogID:  commandLogID,
+				Command:       code.Command,
+				CommandCode:   code.Code,
+				MaxCodeLength: code.MaxCodeLength,
+			}
+			codeJSON, err := json.Marshal(insertedCode)
+			if err != nil {
+				return err
+			}
+			if err := logCodes.Put(itob(insertedCode.ID), codeJSON); err != nil {
+				return err
+			}
+		}
+
+		commandCodes, err = readCommandCodes(tx, commandLogID)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error inserting into CommandCode bucket", "err", err)
+		return nil, err
+	}
+
+	return commandCodes, nil
+}
+
+func (db *BoltDB) DeleteOldCommandLogs(ctx context.Context, policy RetentionPolicy) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		commandLogs, err := readCommandLogs(tx)
+		if err != nil {
+			return err
+		}
+
+		logs := tx.Bucket(commandLogBucket)
+		codes := tx.Bucket(commandCodeBucket)
+		for id := range selectExpiredCommandLogs(commandLogs, policy) {
+			if err := logs.Delete(itob(id)); err != nil {
+				return err
+			}
+			// ON DELETE CASCADE
+			if err := codes.DeleteBucket(itob(id)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error deleting old command logs from CommandLog bucket", "err", err)
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// Ping checks that the database file can be read and the buckets exist
+func (db *BoltDB) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{commandLogBucket, commandCodeBucket} {
+			if tx.Bucket(bucket) == nil {
+				return fmt.Errorf("bucket %s does not exist", bucket)
+			}
+		}
+		return nil
+	})
+}
+
+// SchemaVersion - buckets are created by Init, there are no migrations
+func (db *BoltDB) SchemaVersion(_ context.Context) (int, int, error) {
+	return 0, 0, nil
+}
+
+func (db *BoltDB) Close() error {
+	return db.db.Close()
+}
+
+//Create buckets
+
+func (db *BoltDB) createCommandLogBucket() error {
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(commandLogBucket)
+		return err
+	})
+	if err != nil {
+		slog.Error("Error creating CommandLog bucket", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (db *BoltDB) createCommandCodeBucket() error {
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(commandCodeBucket)
+		return err
+	})
+	if err != nil {
+		slog.Error("Error creating CommandCode bucket", "err", err)
+		return err
+	}
+
+	return nil
+}
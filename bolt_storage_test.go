@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+// newTestBoltDB returns an initialized BoltDB in a temporary file, closed at the end of the test
+func newTestBoltDB(t *testing.T) *BoltDB {
+	t.Helper()
+	db, err := NewBoltDB(filepath.Join(t.TempDir(), "commands.db"))
+	if err != nil {
+		t.Fatalf("NewBoltDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return db
+}
+
+func TestBoltDBStorage(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage { return newTestBoltDB(t) })
+}
+
+func TestBoltDBKeepsDataAfterReopening(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "commands.db")
+
+	db, err := NewBoltDB(path)
+	if err != nil {
+		t.Fatalf("NewBoltDB: %v", err)
+	}
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	commandLog, err := db.SetCommandLog(ctx, &CommandLog{Commands: []string{"UP", "UP", "DOWN"}})
+	if err != nil {
+		t.Fatalf("SetCommandLog: %v", err)
+	}
+	codes, err := db.SetCommandCodes(ctx, []CommandCode{{Command: "UP", Code: "1"}, {Command: "DOWN", Code: "0"}}, commandLog.ID)
+	if err != nil {
+		t.Fatalf("SetCommandCodes: %v", err)
+	}
+	db.Close()
+
+	db, err = NewBoltDB(path)
+	if err != nil {
+		t.Fatalf("NewBoltDB again: %v", err)
+	}
+	defer db.Close()
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init again: %v", err)
+	}
+
+	if got, err := db.GetCommandLog(ctx, commandLog.ID); err != nil || !slices.Equal(got.Commands, commandLog.Commands) {
+		t.Fatalf("GetCommandLog after reopening = %+v, %v, want %+v", got, err, commandLog)
+	}
+	if got, err := db.GetCommandCodesForCommandLog(ctx, commandLog.ID); err != nil || !slices.Equal(got, codes) {
+		t.Fatalf("GetCommandCodesForCommandLog after reopening = %+v, %v, want %+v", got, err, codes)
+	}
+	// ids continue after the stored ones
+	if next, err := db.SetCommandLog(ctx, &CommandLog{Commands: []string{"LEFT"}}); err != nil || next.ID != commandLog.ID+1 {
+		t.Fatalf("SetCommandLog after reopening = %+v, %v, want id %d", next, err, commandLog.ID+1)
+	}
+}
+
+func TestBoltDBInitDeletesEmptyCodes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "commands.db")
+
+	db, err := NewBoltDB(path)
+	if err != nil {
+		t.Fatalf("NewBoltDB: %v", err)
+	}
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	legacy, _ := db.SetCommandLog(ctx, &CommandLog{Commands: []string{"UP", "UP"}})
+	valid, _ := db.SetCommandLog(ctx, &CommandLog{Commands: []string{"UP", "DOWN"}})
+	// older versions gave the only command of a log the empty code
+	if _, err := db.SetCommandCodes(ctx, []CommandCode{{Command: "UP", Code: ""}}, legacy.ID); err != nil {
+		t.Fatalf("SetCommandCodes: %v", err)
+	}
+	validCodes, err := db.SetCommandCodes(ctx, []CommandCode{{Command: "UP", Code: "0"}, {Command: "DOWN", Code: "1"}}, valid.ID)
+	if err != nil {
+		t.Fatalf("SetCommandCodes: %v", err)
+	}
+	db.Close()
+
+	db, err = NewBoltDB(path)
+	if err != nil {
+		t.Fatalf("NewBoltDB again: %v", err)
+	}
+	defer db.Close()
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init again: %v", err)
+	}
+
+	if codes, err := db.GetCommandCodesForCommandLog(ctx, legacy.ID); err != nil || len(codes) != 0 {
+		t.Fatalf("codes of the legacy log = %+v, %v, want none", codes, err)
+	}
+	if codes, err := db.GetCommandCodesForCommandLog(ctx, valid.ID); err != nil || !slices.Equal(codes, validCodes) {
+		t.Fatalf("codes of the valid log = %+v, %v, want %+v", codes, err, validCodes)
+	}
+
+	// the codes are generated again on the next request
+	handler := NewApiServer(":0", ServerConfig{}, db, generate_codes.AlgorithmHuffman, 0).router()
+	got := decodeResponse[CommandCodeOnly](t, doRequest(t, handler, "GET", "/commands/1/rcr/UP", ""), http.StatusOK)
+	if got.CommandCode != "0" {
+		t.Fatalf("GET /commands/1/rcr/UP = %q, want %q", got.CommandCode, "0")
+	}
+}
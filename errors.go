@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+// Errors returned by the API.
+// Every error is sent as application/problem+json (RFC 9457) with an extra machine-readable "code" field,
+// e.g. {"type":"about:blank","title":"Not Found","status":404,"detail":"command not found","code":"command_not_found"}
+
+// Error codes
+const (
+	CodeNotFound           = "not_found"
+	CodeCommandNotFound    = "command_not_found"
+	CodeCommandLogNotFound = "command_log_not_found"
+	CodeNoCommandLogs      = "no_command_logs"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeInvalidJSON        = "invalid_json"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnknownCommand     = "unknown_command"
+	CodeInvalidBitstream   = "invalid_bitstream"
+	CodeInvalidCodebook    = "invalid_codebook"
+	CodeConflict           = "conflict"
+	CodeRequestCanceled    = "request_canceled"
+	CodeStorageTimeout     = "storage_timeout"
+	CodeStorageUnavailable = "storage_unavailable"
+	CodeInternal           = "internal"
+)
+
+// ErrCommandLogNotFound is returned when there is no command log with the given id
+var ErrCommandLogNotFound = errors.New("command log not found")
+
+// ErrNoCommandLogs is returned when the latest command log is requested, but no log was stored yet
+var ErrNoCommandLogs = errors.New("no command logs yet")
+
+type APIError struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	// details of validation errors, one per invalid field
+	Errors []FieldError `json:"errors,omitempty"`
+
+	cause error // not sent to the client
+}
+
+func (e *APIError) Error() string {
+	return e.Detail
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+func newAPIError(status int, code string, detail string, cause error) *APIError {
+	return &APIError{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		cause:  cause,
+	}
+}
+
+func NewNotFoundError(code string, cause error) *APIError {
+	return newAPIError(http.StatusNotFound, code, cause.Error(), cause)
+}
+
+func NewValidationError(code string, cause error) *APIError {
+	return newAPIError(http.StatusUnprocessableEntity, code, cause.Error(), cause)
+}
+
+func NewFieldValidationError(fieldErrors []FieldError) *APIError {
+	apiErr := newAPIError(http.StatusUnprocessableEntity, CodeValidationFailed, "request body is invalid", nil)
+	apiErr.Errors = fieldErrors
+	return apiErr
+}
+
+func NewQueryValidationError(fieldErrors []FieldError) *APIError {
+	apiErr := newAPIError(http.StatusBadRequest, CodeValidationFailed, "query parameters are invalid", nil)
+	apiErr.Errors = fieldErrors
+	return apiErr
+}
+
+func NewBadRequestError(code string, cause error) *APIError {
+	return newAPIError(http.StatusBadRequest, code, cause.Error(), cause)
+}
+
+func NewConflictError(cause error) *APIError {
+	return newAPIError(http.StatusConflict, CodeConflict, cause.Error(), cause)
+}
+
+// StatusClientClosedRequest is sent (and counted in the metrics) when the client went away
+// before the response was ready - the nginx convention, there is no standard status for it
+const StatusClientClosedRequest = 499
+
+// NewInternalError hides the cause from the client, it is only logged
+func NewInternalError(cause error) *APIError {
+	return newAPIError(http.StatusInternalServerError, CodeInternal, "internal server error", cause)
+}
+
+// toAPIError turns any error returned by a handler into an APIError
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var base64Err base64.CorruptInputError
+
+	switch {
+	case errors.Is(err, ErrStorageTimeout):
+		return newAPIError(http.StatusGatewayTimeout, CodeStorageTimeout, "storage operation timed out", err)
+	case errors.Is(err, context.Canceled):
+		// not a server error, so it is not logged as one
+		apiErr := newAPIError(StatusClientClosedRequest, CodeRequestCanceled, "request canceled by the client", err)
+		apiErr.Title = "Client Closed Request"
+		return apiErr
+	case errors.Is(err, ErrStorageUnavailable):
+		return newAPIError(http.StatusServiceUnavailable, CodeStorageUnavailable, "storage unavailable", err)
+	case errors.Is(err, ErrCommandNotFound):
+		return NewNotFoundError(CodeCommandNotFound, err)
+	case errors.Is(err, ErrCommandLogNotFound):
+		return NewNotFoundError(CodeCommandLogNotFound, err)
+	case errors.Is(err, ErrNoCommandLogs):
+		return NewNotFoundError(CodeNoCommandLogs, err)
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return NewBadRequestError(CodeInvalidJSON, err)
+	case errors.As(err, &base64Err):
+		return NewBadRequestError(CodeValidationFailed, err)
+	case errors.Is(err, generate_codes.ErrUnknownCommand):
+		return NewValidationError(CodeUnknownCommand, err)
+	case errors.Is(err, generate_codes.ErrTruncatedInput), errors.Is(err, generate_codes.ErrInvalidPrefix):
+		return NewValidationError(CodeInvalidBitstream, err)
+	case errors.Is(err, generate_codes.ErrInvalidCode), errors.Is(err, generate_codes.ErrNotPrefixFree),
+		errors.Is(err, generate_codes.ErrInvalidCodebook):
+		// the stored codes of the log can't be used, e.g. the empty code of a single command stored by older versions
+		return NewValidationError(CodeInvalidCodebook, err)
+	case errors.Is(err, generate_codes.ErrMaxCodeLengthTooSmall), errors.Is(err, generate_codes.ErrInvalidMaxCodeLength),
+		errors.Is(err, generate_codes.ErrInvalidWeight):
+		return NewValidationError(CodeValidationFailed, err)
+	}
+
+	return NewInternalError(err)
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr *APIError) error {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(apiErr.Status)
+
+	return json.NewEncoder(w).Encode(apiErr)
+}
+
+// notFoundHandler and methodNotAllowedHandler send router errors in the same format as the handlers
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, NewNotFoundError(CodeNotFound, errors.New("no such endpoint: "+r.URL.Path)))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, newMethodNotAllowedError(r.Method))
+}
+
+func newMethodNotAllowedError(method string) *APIError {
+	return newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "request method not allowed: "+method, nil)
+}
+
+// logInternalError logs the cause of server errors, it is not sent to the client
+func logInternalError(r *http.Request, apiErr *APIError) {
+	if apiErr.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "err", apiErr.cause)
+	}
+}
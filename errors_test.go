@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+func TestToAPIError(t *testing.T) {
+	storageTimeout := storageError(context.Background(), context.DeadlineExceeded)
+
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{err: NewConflictError(errors.New("already exists")), wantStatus: http.StatusConflict, wantCode: CodeConflict},
+		{err: fmt.Errorf("reading: %w", storageTimeout), wantStatus: http.StatusGatewayTimeout, wantCode: CodeStorageTimeout},
+		{err: fmt.Errorf("reading: %w", ErrStorageUnavailable), wantStatus: http.StatusServiceUnavailable, wantCode: CodeStorageUnavailable},
+		{err: fmt.Errorf("reading: %w", context.Canceled), wantStatus: StatusClientClosedRequest, wantCode: CodeRequestCanceled},
+		{err: ErrCommandNotFound, wantStatus: http.StatusNotFound, wantCode: CodeCommandNotFound},
+		{err: ErrCommandLogNotFound, wantStatus: http.StatusNotFound, wantCode: CodeCommandLogNotFound},
+		{err: ErrNoCommandLogs, wantStatus: http.StatusNotFound, wantCode: CodeNoCommandLogs},
+		{err: &json.SyntaxError{}, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{err: io.ErrUnexpectedEOF, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{err: base64.CorruptInputError(3), wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed},
+		{err: fmt.Errorf("%w: GRAB", generate_codes.ErrUnknownCommand), wantStatus: http.StatusUnprocessableEntity, wantCode: CodeUnknownCommand},
+		{err: generate_codes.ErrTruncatedInput, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeInvalidBitstream},
+		{err: generate_codes.ErrInvalidPrefix, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeInvalidBitstream},
+		{err: generate_codes.ErrInvalidCode, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeInvalidCodebook},
+		{err: generate_codes.ErrNotPrefixFree, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeInvalidCodebook},
+		{err: generate_codes.ErrInvalidCodebook, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeInvalidCodebook},
+		{err: generate_codes.ErrMaxCodeLengthTooSmall, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed},
+		{err: generate_codes.ErrInvalidWeight, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed},
+		{err: errors.New("connection reset"), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+	}
+
+	for _, tt := range tests {
+		apiErr := toAPIError(tt.err)
+		if apiErr.Status != tt.wantStatus || apiErr.Code != tt.wantCode || apiErr.Title == "" {
+			t.Errorf("toAPIError(%v) = %d %q %q, want %d %q", tt.err, apiErr.Status, apiErr.Code, apiErr.Title, tt.wantStatus, tt.wantCode)
+		}
+		if !errors.Is(apiErr, tt.err) {
+			t.Errorf("toAPIError(%v) doesn't wrap the error", tt.err)
+		}
+	}
+
+	// the cause of internal errors is not sent to the client
+	if apiErr := toAPIError(errors.New("password authentication failed")); apiErr.Detail != "internal server error" {
+		t.Errorf("internal error detail %q, want the cause to be hidden", apiErr.Detail)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	handler, _ := newTestServer(t)
+
+	// before the first log is stored
+	checkErrorResponse(t, handler, "GET", "/rcr/UP", "", http.StatusNotFound, CodeNoCommandLogs)
+
+	postCommandLog(t, handler, "UP", "UP", "DOWN")
+
+	tests := []struct {
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{method: "GET", target: "/nothing", wantStatus: http.StatusNotFound, wantCode: CodeNotFound},
+		{method: "GET", target: "/commands/abc", wantStatus: http.StatusNotFound, wantCode: CodeNotFound},
+		{method: "DELETE", target: "/commands", wantStatus: http.StatusMethodNotAllowed, wantCode: CodeMethodNotAllowed},
+		{method: "GET", target: "/encode", wantStatus: http.StatusMethodNotAllowed, wantCode: CodeMethodNotAllowed},
+		{method: "GET", target: "/commands/9", wantStatus: http.StatusNotFound, wantCode: CodeCommandLogNotFound},
+		{method: "GET", target: "/commands/9/codes", wantStatus: http.StatusNotFound, wantCode: CodeCommandLogNotFound},
+		{method: "GET", target: "/rcr/GRAB", wantStatus: http.StatusNotFound, wantCode: CodeCommandNotFound},
+		{method: "GET", target: "/rcr/UP?log=abc", wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed},
+		{method: "GET", target: "/commands/1/tree?format=svg", wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed},
+		{method: "POST", target: "/encode", body: `{"commands": ["UP"`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{method: "POST", target: "/encode", body: `{"commandLogId": 9, "commands": ["UP"]}`, wantStatus: http.StatusNotFound, wantCode: CodeCommandLogNotFound},
+		{method: "POST", target: "/encode", body: `{"commands": ["UP", "GRAB"]}`, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeUnknownCommand},
+		{method: "POST", target: "/decode", body: `{"data": "!!", "bitLength": 1}`, wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed},
+		// "UP" has a 1-bit code, 9 bits are more than the data
+		{method: "POST", target: "/decode", body: `{"data": "AA==", "bitLength": 9}`, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeInvalidBitstream},
+		{method: "POST", target: "/decode", body: `{"data": "AA==", "bitLength": 1, "method": "magic"}`, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed},
+	}
+
+	for _, tt := range tests {
+		checkErrorResponse(t, handler, tt.method, tt.target, tt.body, tt.wantStatus, tt.wantCode)
+	}
+}
+
+func TestCodesThatCantBeGeneratedAreAConflict(t *testing.T) {
+	// the default limit is too small for the 3 commands of the log
+	storage := NewMemoryStorage()
+	handler := NewApiServer(":0", ServerConfig{}, storage, generate_codes.AlgorithmHuffman, 1).router()
+	postCommandLog(t, handler, "UP", "DOWN", "LEFT")
+
+	checkErrorResponse(t, handler, "GET", "/commands/1/codes", "", http.StatusConflict, CodeConflict)
+}
+
+func TestEmptyCodeIsAnInvalidCodebook(t *testing.T) {
+	handler, storage := newTestServer(t)
+	commandLog := postCommandLog(t, handler, "UP", "UP")
+	// older versions gave the only command of a log the empty code
+	if _, err := storage.SetCommandCodes(context.Background(), []CommandCode{{Command: "UP", Code: ""}}, commandLog.ID); err != nil {
+		t.Fatalf("SetCommandCodes: %v", err)
+	}
+
+	checkErrorResponse(t, handler, "POST", "/encode", `{"commands": ["UP"]}`, http.StatusUnprocessableEntity, CodeInvalidCodebook)
+	checkErrorResponse(t, handler, "POST", "/decode", `{"data": "AA==", "bitLength": 1}`, http.StatusUnprocessableEntity, CodeInvalidCodebook)
+	checkErrorResponse(t, handler, "POST", "/decode", `{"data": "AA==", "bitLength": 1, "method": "tree"}`, http.StatusUnprocessableEntity, CodeInvalidCodebook)
+	checkErrorResponse(t, handler, "GET", "/commands/1/codebook", "", http.StatusUnprocessableEntity, CodeInvalidCodebook)
+}
+
+func checkErrorResponse(t *testing.T, handler http.Handler, method string, target string, body string, wantStatus int, wantCode string) {
+	t.Helper()
+	recorder := doRequest(t, handler, method, target, body)
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("%s %s: Content-Type %q, body %s", method, target, contentType, recorder.Body)
+		return
+	}
+
+	var apiErr APIError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &apiErr); err != nil {
+		t.Errorf("%s %s: decoding %s: %v", method, target, recorder.Body, err)
+		return
+	}
+	if recorder.Code != wantStatus || apiErr.Status != wantStatus || apiErr.Code != wantCode {
+		t.Errorf("%s %s: status %d, body %s, want %d %q", method, target, recorder.Code, recorder.Body, wantStatus, wantCode)
+	}
+}
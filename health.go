@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health checks for docker compose and orchestrators:
+//   - /healthz - the process is alive and serves requests (liveness), it doesn't check dependencies,
+//     so a database outage doesn't restart the service
+//   - /readyz - the service can handle requests (readiness): the storage is reachable and migrations are applied
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// readinessTimeout limits all checks of one /readyz request, probes usually time out after a few seconds
+const readinessTimeout = 2 * time.Second
+
+type HealthResponse struct {
+	Status string `json:"status"`
+	// per dependency, only in /readyz
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+type DependencyStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (s *simpleAPIServer) handleHealthz(w http.ResponseWriter, r *http.Request) error {
+	return writeJson(w, http.StatusOK, HealthResponse{Status: StatusOK})
+}
+
+func (s *simpleAPIServer) handleReadyz(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	response := HealthResponse{
+		Status: StatusOK,
+		Checks: make(map[string]DependencyStatus),
+	}
+
+	response.Checks["storage"] = s.checkStorage(ctx)
+	// migrations can't be checked without the storage
+	if response.Checks["storage"].Status == StatusOK {
+		if migrations, ok := s.checkMigrations(ctx); ok {
+			response.Checks["migrations"] = migrations
+		}
+	}
+
+	status := http.StatusOK
+	for _, check := range response.Checks {
+		if check.Status != StatusOK {
+			response.Status = StatusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	return writeJson(w, status, response)
+}
+
+func (s *simpleAPIServer) checkStorage(ctx context.Context) DependencyStatus {
+	if err := s.storage.Ping(ctx); err != nil {
+		return DependencyStatus{Status: StatusUnavailable, Detail: err.Error()}
+	}
+	return DependencyStatus{Status: StatusOK}
+}
+
+// checkMigrations returns false for storages without migrations
+func (s *simpleAPIServer) checkMigrations(ctx context.Context) (DependencyStatus, bool) {
+	version, latest, err := s.storage.SchemaVersion(ctx)
+	if err != nil {
+		return DependencyStatus{Status: StatusUnavailable, Detail: err.Error()}, true
+	}
+	if latest == 0 {
+		return DependencyStatus{}, false
+	}
+
+	detail := fmt.Sprintf("schema version %d, newest %d", version, latest)
+	// a newer schema is fine - it happens during a rolling deploy, after a new replica migrated the database
+	if version < latest {
+		return DependencyStatus{Status: StatusUnavailable, Detail: detail}, true
+	}
+	return DependencyStatus{Status: StatusOK, Detail: detail}, true
+}
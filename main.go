@@ -1,29 +1,187 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"command-encoding-service/pkg/config"
 )
 
-func loadEnv() {
-	err := godotenv.Load()
+// loadEnv reads the .env file, if there is one - its variables are not set in the environment,
+// config.Load uses them only in place of the defaults
+func loadEnv() (map[string]string, error) {
+	dotEnv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return dotEnv, nil
+}
+
+// fatal logs the error and exits, deferred functions are not run
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// newStorage creates the storage backend: "postgres", "bolt" (embedded, file-backed) or "memory"
+func newStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "postgres":
+		db, err := NewSimplePostgressDB(cfg.Postgres)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Init(); err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "bolt":
+		db, err := NewBoltDB(cfg.Bolt.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Init(); err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "memory":
+		slog.Warn("Using in-memory storage - data is lost when the service stops")
+		return NewMemoryStorage(), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage.Backend)
+}
+
+// runMigrate runs the migrate command on the Postgres database:
+// migrate up - apply all new migrations, migrate down [n] - revert the last n (default 1) migrations,
+// migrate version - print the schema version
+func runMigrate(cfg *config.Config, args []string) error {
+	db, err := NewSimplePostgressDB(cfg.Postgres)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down [n] | version")
+	}
+
+	switch args[0] {
+	case "up":
+		if err := migrator.Up(); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %s", args[1])
+			}
+		}
+		if err := migrator.Down(steps); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+
+	version, err := migrator.Version()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return err
+	}
+	slog.Info("Schema version", "version", version, "newest", migrator.Latest())
+	return nil
+}
+
+// runServer serves the API until SIGINT or SIGTERM,
+// then drains in-flight requests, stops the janitor and closes the storage - in this order
+func runServer(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backend, err := newStorage(cfg)
+	if err != nil {
+		return err
+	}
+	timeoutStorage := NewTimeoutStorage(backend, StorageTimeouts{
+		Read:  cfg.Storage.ReadTimeout,
+		Write: cfg.Storage.WriteTimeout,
+		Clean: cfg.Storage.CleanTimeout,
+	})
+	db := NewMetricsStorage(timeoutStorage)
+	// scrapes are not measured as storage operations
+	prometheus.MustRegister(NewCodebookCollector(timeoutStorage))
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Error("Error closing storage", "err", err)
+		}
+	}()
+
+	retentionPolicy := RetentionPolicy{
+		MaxLogs: cfg.Retention.MaxLogs,
+		MaxAge:  cfg.Retention.MaxAge,
 	}
+	janitor := NewRetentionJanitor(db, retentionPolicy, cfg.Retention.Interval)
+	janitor.Start()
+	defer janitor.Stop()
+
+	serverConfig := ServerConfig{
+		ReadTimeout:     cfg.HTTP.ReadTimeout,
+		WriteTimeout:    cfg.HTTP.WriteTimeout,
+		IdleTimeout:     cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes:  cfg.HTTP.MaxHeaderBytes,
+		ShutdownTimeout: cfg.HTTP.ShutdownTimeout,
+	}
+	server := NewApiServer(cfg.ListenAddress, serverConfig, db, cfg.Coding.CodeAlgorithm(), cfg.Coding.MaxCodeLength)
+	if err := server.Run(ctx); err != nil {
+		return err
+	}
+
+	slog.Info("Server stopped")
+	return nil
 }
 
 func main() {
-	loadEnv()
+	dotEnv, err := loadEnv()
+	if err != nil {
+		fatal("Error loading .env file", err)
+	}
 
-	db, err := NewSimplePostgressDB()
+	cfg, args, err := config.Load(os.Args[1:], dotEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal("Invalid configuration", err)
 	}
-	if err := db.Init(); err != nil {
-		log.Fatal(err)
+	slog.SetDefault(NewLogger(os.Stderr, cfg.Log))
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(cfg, args[1:]); err != nil {
+			fatal("Migration failed", err)
+		}
+		return
 	}
 
-	server := NewApiServer(":3000", db)
-	server.Run()
+	if err := runServer(cfg); err != nil {
+		fatal("Server failed", err)
+	}
 }
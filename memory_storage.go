@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps command logs and codes in memory - for running without a database and for tests.
+// It behaves like SimplePostgresDB: ids start at 1 and are never reused,
+// missing command logs are reported with sql.ErrNoRows and codes are deleted together with their log.
+type MemoryStorage struct {
+	mu           sync.RWMutex
+	commandLogs  []*CommandLogRequest // sorted by id
+	commandCodes []CommandCodeRequest // sorted by id
+	lastLogID    int
+	lastCodeID   int
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+// copyCommandLog returns a copy, so callers can't change the stored log
+func copyCommandLog(commandLog *CommandLogRequest) *CommandLogRequest {
+	commandLogCopy := *commandLog
+	if commandLog.Commands != nil {
+		commandLogCopy.Commands = append([]string(nil), commandLog.Commands...)
+	}
+	return &commandLogCopy
+}
+
+func (m *MemoryStorage) SetCommandLog(_ context.Context, commandsLog *CommandLog) (*CommandLogRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastLogID++
+	commandLog := &CommandLogRequest{
+		ID:            m.lastLogID,
+		Commands:      commandsLog.Commands,
+		Timestamp:     time.Now().UTC(),
+		MaxCodeLength: commandsLog.MaxCodeLength,
+	}
+	m.commandLogs = append(m.commandLogs, copyCommandLog(commandLog))
+
+	return commandLog, nil
+}
+
+func (m *MemoryStorage) ListCommandLogs(_ context.Context, filter CommandLogFilter) ([]*CommandLogRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	commandLogs := selectPage(m.commandLogs, filter.Order, filter.Limit, filter.matches)
+	for i, commandLog := range commandLogs {
+		commandLogs[i] = copyCommandLog(commandLog)
+	}
+	return commandLogs, nil
+}
+
+func (m *MemoryStorage) ListCommandCodes(_ context.Context, filter CommandCodeFilter) ([]CommandCodeRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return selectPage(m.commandCodes, filter.Order, filter.Limit, func(code CommandCodeRequest) bool {
+		// codes are deleted together with their log, so the log exists
+		return filter.matches(code, m.findCommandLog(code.CommandLogID).Timestamp)
+	}), nil
+}
+
+func (m *MemoryStorage) CountCommandLogs(_ context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.commandLogs), nil
+}
+
+func (m *MemoryStorage) GetLatestCommandLog(_ context.Context) (*CommandLogRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest *CommandLogRequest
+	for _, commandLog := range m.commandLogs {
+		// the same timestamp - the later id wins
+		if latest == nil || !commandLog.Timestamp.Before(latest.Timestamp) {
+			latest = commandLog
+		}
+	}
+
+	if latest == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyCommandLog(latest), nil
+}
+
+func (m *MemoryStorage) GetCommandLog(_ context.Context, id int) (*CommandLogRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	commandLog := m.findCommandLog(id)
+	if commandLog == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyCommandLog(commandLog), nil
+}
+
+// findCommandLog expects the lock to be held
+func (m *MemoryStorage) findCommandLog(id int) *CommandLogRequest {
+	i := sort.Search(len(m.commandLogs), func(i int) bool { return m.commandLogs[i].ID >= id })
+	if i < len(m.commandLogs) && m.commandLogs[i].ID == id {
+		return m.commandLogs[i]
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetCommandCodesForCommandLog(_ context.Context, commandLogID int) ([]CommandCodeRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var commandCodes []CommandCodeRequest
+	for _, code := range m.commandCodes {
+		if code.CommandLogID == commandLogID {
+			commandCodes = append(commandCodes, code)
+		}
+	}
+	return commandCodes, nil
+}
+
+func (m *MemoryStorage) SetCommandCodes(_ context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// like the foreign key in CommandCode table
+	if m.findCommandLog(commandLogID) == nil {
+		return nil, fmt.Errorf("command log %d does not exist", commandLogID)
+	}
+
+	// like the unique (commandLogID, command) constraint - codes stored first are kept
+	existing := make(map[string]bool)
+	for _, code := range m.commandCodes {
+		if code.CommandLogID == commandLogID {
+			existing[code.Command] = true
+		}
+	}
+
+	for _, code := range codes {
+		if existing[code.Command] {
+			continue
+		}
+		existing[code.Command] = true
+
+		m.lastCodeID++
+		insertedCode := CommandCodeRequest{
+			ID:            m.lastCodeID,
+			CommandLogID:  commandLogID,
+			Command:       code.Command,
+			CommandCode:   code.Code,
+			MaxCodeLength: code.MaxCodeLength,
+		}
+		m.commandCodes = append(m.commandCodes, insertedCode)
+	}
+
+	var commandCodes []CommandCodeRequest
+	for _, code := range m.commandCodes {
+		if code.CommandLogID == commandLogID {
+			commandCodes = append(commandCodes, code)
+		}
+	}
+	return commandCodes, nil
+}
+
+// Ping always succeeds, the data is in the process
+func (m *MemoryStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *MemoryStorage) SchemaVersion(_ context.Context) (int, int, error) {
+	return 0, 0, nil
+}
+
+// Close does nothing, the data is lost when the process exits
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+func (m *MemoryStorage) DeleteOldCommandLogs(_ context.Context, policy RetentionPolicy) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deletedIDs := selectExpiredCommandLogs(m.commandLogs, policy)
+	if len(deletedIDs) == 0 {
+		return 0, nil
+	}
+
+	keptLogs := m.commandLogs[:0]
+	for _, commandLog := range m.commandLogs {
+		if !deletedIDs[commandLog.ID] {
+			keptLogs = append(keptLogs, commandLog)
+		}
+	}
+	m.commandLogs = keptLogs
+
+	// ON DELETE CASCADE
+	keptCodes := m.commandCodes[:0]
+	for _, code := range m.commandCodes {
+		if !deletedIDs[code.CommandLogID] {
+			keptCodes = append(keptCodes, code)
+		}
+	}
+	m.commandCodes = keptCodes
+
+	return len(deletedIDs), nil
+}
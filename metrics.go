@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+// Prometheus metrics, served on /metrics.
+// Metrics are registered in the default registry (with the Go runtime and process metrics).
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "command_encoding_http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "command_encoding_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route template and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	storageOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "command_encoding_storage_operation_duration_seconds",
+		Help:    "Duration of storage operations by operation and result (ok, not_found, timeout, canceled, unavailable, error).",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation", "result"})
+
+	codeLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "command_encoding_code_lookups_total",
+		Help: "Codebook lookups by result: cache_hit (codes already stored), generated or failed.",
+	}, []string{"result"})
+
+	codeGenerationDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "command_encoding_code_generation_duration_seconds",
+		Help:    "Duration of generating the codes of a command log.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+)
+
+// metricsMiddleware measures requests to the routes of the router,
+// the route template (e.g. /commands/{id:[0-9]+}) is used as the label, so ids don't create new series
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if currentRoute := mux.CurrentRoute(r); currentRoute != nil {
+			if template, err := currentRoute.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+// statusRecorder remembers the status code and the size of the response written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// storageResult returns the result label of a storage operation
+func storageResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, sql.ErrNoRows):
+		return "not_found"
+	case errors.Is(err, ErrStorageTimeout):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrStorageUnavailable):
+		return "unavailable"
+	}
+	return "error"
+}
+
+// metricsStorage wraps a Storage and measures every operation,
+// it should wrap timeoutStorage, so timeouts are reported as such
+type metricsStorage struct {
+	storage Storage
+}
+
+func NewMetricsStorage(storage Storage) *metricsStorage {
+	return &metricsStorage{storage: storage}
+}
+
+func observeStorage(operation string, start time.Time, err error) {
+	storageOperationDuration.WithLabelValues(operation, storageResult(err)).Observe(time.Since(start).Seconds())
+}
+
+func (s *metricsStorage) SetCommandLog(ctx context.Context, commandLog *CommandLog) (*CommandLogRequest, error) {
+	start := time.Now()
+	commandLogRequest, err := s.storage.SetCommandLog(ctx, commandLog)
+	observeStorage("SetCommandLog", start, err)
+	return commandLogRequest, err
+}
+
+func (s *metricsStorage) ListCommandLogs(ctx context.Context, filter CommandLogFilter) ([]*CommandLogRequest, error) {
+	start := time.Now()
+	commandLogs, err := s.storage.ListCommandLogs(ctx, filter)
+	observeStorage("ListCommandLogs", start, err)
+	return commandLogs, err
+}
+
+func (s *metricsStorage) ListCommandCodes(ctx context.Context, filter CommandCodeFilter) ([]CommandCodeRequest, error) {
+	start := time.Now()
+	commandCodes, err := s.storage.ListCommandCodes(ctx, filter)
+	observeStorage("ListCommandCodes", start, err)
+	return commandCodes, err
+}
+
+func (s *metricsStorage) CountCommandLogs(ctx context.Context) (int, error) {
+	start := time.Now()
+	count, err := s.storage.CountCommandLogs(ctx)
+	observeStorage("CountCommandLogs", start, err)
+	return count, err
+}
+
+func (s *metricsStorage) GetLatestCommandLog(ctx context.Context) (*CommandLogRequest, error) {
+	start := time.Now()
+	commandLog, err := s.storage.GetLatestCommandLog(ctx)
+	observeStorage("GetLatestCommandLog", start, err)
+	return commandLog, err
+}
+
+func (s *metricsStorage) GetCommandLog(ctx context.Context, id int) (*CommandLogRequest, error) {
+	start := time.Now()
+	commandLog, err := s.storage.GetCommandLog(ctx, id)
+	observeStorage("GetCommandLog", start, err)
+	return commandLog, err
+}
+
+func (s *metricsStorage) GetCommandCodesForCommandLog(ctx context.Context, commandLogID int) ([]CommandCodeRequest, error) {
+	start := time.Now()
+	commandCodes, err := s.storage.GetCommandCodesForCommandLog(ctx, commandLogID)
+	observeStorage("GetCommandCodesForCommandLog", start, err)
+	return commandCodes, err
+}
+
+func (s *metricsStorage) SetCommandCodes(ctx context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
+	start := time.Now()
+	commandCodes, err := s.storage.SetCommandCodes(ctx, codes, commandLogID)
+	observeStorage("SetCommandCodes", start, err)
+	return commandCodes, err
+}
+
+func (s *metricsStorage) DeleteOldCommandLogs(ctx context.Context, policy RetentionPolicy) (int, error) {
+	start := time.Now()
+	deleted, err := s.storage.DeleteOldCommandLogs(ctx, policy)
+	observeStorage("DeleteOldCommandLogs", start, err)
+	return deleted, err
+}
+
+func (s *metricsStorage) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.storage.Ping(ctx)
+	observeStorage("Ping", start, err)
+	return err
+}
+
+func (s *metricsStorage) SchemaVersion(ctx context.Context) (int, int, error) {
+	start := time.Now()
+	version, latest, err := s.storage.SchemaVersion(ctx)
+	observeStorage("SchemaVersion", start, err)
+	return version, latest, err
+}
+
+func (s *metricsStorage) Close() error {
+	return s.storage.Close()
+}
+
+// codebookCollector reads the gauges of the stored data from the storage when Prometheus scrapes /metrics
+type codebookCollector struct {
+	storage Storage
+
+	commandLogs          *prometheus.Desc
+	distinctCommands     *prometheus.Desc
+	averageCodeLength    *prometheus.Desc
+	latestCommandLogInfo *prometheus.Desc
+}
+
+// collectTimeout limits the storage queries of one scrape
+const collectTimeout = 5 * time.Second
+
+func NewCodebookCollector(storage Storage) *codebookCollector {
+	return &codebookCollector{
+		storage: storage,
+		commandLogs: prometheus.NewDesc("command_encoding_command_logs",
+			"Number of stored command logs.", nil, nil),
+		distinctCommands: prometheus.NewDesc("command_encoding_latest_codebook_distinct_commands",
+			"Number of distinct commands in the codebook of the latest command log.", nil, nil),
+		averageCodeLength: prometheus.NewDesc("command_encoding_latest_codebook_average_code_length_bits",
+			"Average code length of the commands of the latest command log, weighted by their frequencies (averageCodeLength of /stats).", nil, nil),
+		latestCommandLogInfo: prometheus.NewDesc("command_encoding_latest_command_log_id",
+			"Id of the latest command log.", nil, nil),
+	}
+}
+
+func (c *codebookCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.commandLogs
+	ch <- c.distinctCommands
+	ch <- c.averageCodeLength
+	ch <- c.latestCommandLogInfo
+}
+
+// Collect skips the gauges it can't read, a failing storage must not break the other metrics
+func (c *codebookCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	count, err := c.storage.CountCommandLogs(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting command logs for metrics", "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.commandLogs, prometheus.GaugeValue, float64(count))
+
+	commandLog, err := c.storage.GetLatestCommandLog(ctx)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "Error reading the latest command log for metrics", "err", err)
+		}
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.latestCommandLogInfo, prometheus.GaugeValue, float64(commandLog.ID))
+
+	// only stored codes - scraping doesn't generate codes
+	commandCodes, err := c.storage.GetCommandCodesForCommandLog(ctx, commandLog.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading codes of the latest command log for metrics", "err", err)
+		return
+	}
+	if len(commandCodes) == 0 {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.distinctCommands, prometheus.GaugeValue, float64(len(commandCodes)))
+
+	// the same statistics as GET /commands/{id}/stats, so the gauge and the endpoint agree
+	stats, err := generate_codes.GetStats(commandLog.Commands, ConvertCommandCodesToMap(commandCodes))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error computing statistics of the latest codebook for metrics", "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.averageCodeLength, prometheus.GaugeValue, stats.AverageCodeLength)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Pagination of GET /commands and GET /allCommandCodes.
+// Results are sorted by id (the order in which they were stored) and split into pages of at most ?limit= items.
+// The body is a JSON array, like before pagination, the cursor of the next page is sent in the X-Next-Cursor header -
+// pass it as ?cursor= to get the next page, no header means the last page.
+// The cursor is the id of the last item of the page, so pages don't shift when new items are stored.
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+type SortOrder string
+
+const (
+	OrderAsc  SortOrder = "asc"
+	OrderDesc SortOrder = "desc"
+)
+
+// CommandLogFilter selects command logs, zero values mean no filter
+type CommandLogFilter struct {
+	Limit   int
+	After   int // cursor: id of the last log of the previous page, 0 - the first page
+	Order   SortOrder
+	From    time.Time // timestamp >= From
+	To      time.Time // timestamp < To
+	Command string    // only logs containing the command
+}
+
+// CommandCodeFilter selects command codes, zero values mean no filter
+type CommandCodeFilter struct {
+	Limit        int
+	After        int // cursor: id of the last code of the previous page, 0 - the first page
+	Order        SortOrder
+	CommandLogID int
+	Command      string
+	From         time.Time // timestamp of the command log >= From
+	To           time.Time // timestamp of the command log < To
+}
+
+// NextCursorHeader is the response header with the cursor of the next page
+const NextCursorHeader = "X-Next-Cursor"
+
+// afterCursor reports whether the id comes after the cursor in the given order
+func afterCursor(id int, cursor int, order SortOrder) bool {
+	if cursor == 0 {
+		return true
+	}
+	if order == OrderDesc {
+		return id < cursor
+	}
+	return id > cursor
+}
+
+func inTimeRange(timestamp time.Time, from time.Time, to time.Time) bool {
+	if !from.IsZero() && timestamp.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !timestamp.Before(to) {
+		return false
+	}
+	return true
+}
+
+func (f CommandLogFilter) matches(commandLog *CommandLogRequest) bool {
+	if !afterCursor(commandLog.ID, f.After, f.Order) || !inTimeRange(commandLog.Timestamp, f.From, f.To) {
+		return false
+	}
+	if f.Command == "" {
+		return true
+	}
+	for _, command := range commandLog.Commands {
+		if command == f.Command {
+			return true
+		}
+	}
+	return false
+}
+
+// matches needs the timestamp of the code's command log for the From/To filter
+func (f CommandCodeFilter) matches(code CommandCodeRequest, logTimestamp time.Time) bool {
+	if !afterCursor(code.ID, f.After, f.Order) || !inTimeRange(logTimestamp, f.From, f.To) {
+		return false
+	}
+	if f.CommandLogID != 0 && code.CommandLogID != f.CommandLogID {
+		return false
+	}
+	return f.Command == "" || code.Command == f.Command
+}
+
+// selectPage returns at most limit items that match, items must be sorted by id,
+// for storages that can't do it in a query
+func selectPage[T any](items []T, order SortOrder, limit int, matches func(T) bool) []T {
+	page := []T{}
+	for i := range items {
+		item := items[i]
+		if order == OrderDesc {
+			item = items[len(items)-1-i]
+		}
+
+		if len(page) == limit {
+			break
+		}
+		if matches(item) {
+			page = append(page, item)
+		}
+	}
+	return page
+}
+
+// pageParams are the query parameters shared by both endpoints
+type pageParams struct {
+	limit int
+	after int
+	order SortOrder
+	from  time.Time
+	to    time.Time
+}
+
+// parsePageParams reads ?limit=&cursor=&order=&from=&to=, invalid parameters are added to fieldErrors
+func parsePageParams(r *http.Request, fieldErrors *[]FieldError) pageParams {
+	query := r.URL.Query()
+	params := pageParams{limit: DefaultPageSize, order: OrderAsc}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			*fieldErrors = append(*fieldErrors, FieldError{Field: "limit", Message: fmt.Sprintf("must be a number from 1 to %d", MaxPageSize)})
+		} else {
+			params.limit = limit
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := strconv.Atoi(cursor)
+		if err != nil || after < 1 {
+			*fieldErrors = append(*fieldErrors, FieldError{Field: "cursor", Message: "must be " + NextCursorHeader + " of the previous page"})
+		} else {
+			params.after = after
+		}
+	}
+
+	if order := SortOrder(query.Get("order")); order != "" {
+		if order != OrderAsc && order != OrderDesc {
+			*fieldErrors = append(*fieldErrors, FieldError{Field: "order", Message: "must be asc or desc"})
+		} else {
+			params.order = order
+		}
+	}
+
+	params.from = parseTimeParam(r, "from", fieldErrors)
+	params.to = parseTimeParam(r, "to", fieldErrors)
+
+	return params
+}
+
+func parseTimeParam(r *http.Request, name string, fieldErrors *[]FieldError) time.Time {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		*fieldErrors = append(*fieldErrors, FieldError{Field: name, Message: "must be a RFC 3339 timestamp, e.g. 2024-01-02T15:04:05Z"})
+	}
+	// Postgres ignores the offset of a parameter compared with a TIMESTAMP column,
+	// timestamps are stored in UTC (see SetCommandLog)
+	return timestamp.UTC()
+}
+
+// parseCommandLogFilter reads the filter of GET /commands, the limit is one more than requested
+// to find out if there is a next page
+func parseCommandLogFilter(r *http.Request) (CommandLogFilter, error) {
+	var fieldErrors []FieldError
+	params := parsePageParams(r, &fieldErrors)
+	if len(fieldErrors) > 0 {
+		return CommandLogFilter{}, NewQueryValidationError(fieldErrors)
+	}
+
+	return CommandLogFilter{
+		Limit:   params.limit + 1,
+		After:   params.after,
+		Order:   params.order,
+		From:    params.from,
+		To:      params.to,
+		Command: r.URL.Query().Get("command"),
+	}, nil
+}
+
+// parseCommandCodeFilter reads the filter of GET /allCommandCodes, the limit is one more than requested
+// to find out if there is a next page
+func parseCommandCodeFilter(r *http.Request) (CommandCodeFilter, error) {
+	var fieldErrors []FieldError
+	params := parsePageParams(r, &fieldErrors)
+
+	commandLogID := 0
+	if idStr := r.URL.Query().Get("commandLogId"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id < 1 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "commandLogId", Message: "must be a command log id"})
+		}
+		commandLogID = id
+	}
+
+	if len(fieldErrors) > 0 {
+		return CommandCodeFilter{}, NewQueryValidationError(fieldErrors)
+	}
+
+	return CommandCodeFilter{
+		Limit:        params.limit + 1,
+		After:        params.after,
+		Order:        params.order,
+		CommandLogID: commandLogID,
+		Command:      r.URL.Query().Get("command"),
+		From:         params.from,
+		To:           params.to,
+	}, nil
+}
+
+// nextPage trims the extra item fetched by the parse functions
+// and sets the cursor of the next page in the header, no header if this is the last page
+func nextPage[T any](w http.ResponseWriter, items []T, limit int, id func(T) int) []T {
+	if len(items) < limit {
+		return items
+	}
+
+	page := items[:limit-1]
+	w.Header().Set(NextCursorHeader, strconv.Itoa(id(page[len(page)-1])))
+	return page
+}
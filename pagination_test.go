@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// getAllPages follows the cursors from the first page and returns the ids of the items of all pages
+func getAllPages[T any](t *testing.T, handler http.Handler, target string, id func(T) int) [][]int {
+	t.Helper()
+	var pages [][]int
+	next := target
+	for next != "" {
+		recorder := doRequest(t, handler, "GET", next, "")
+		ids := []int{}
+		for _, item := range decodeResponse[[]T](t, recorder, http.StatusOK) {
+			ids = append(ids, id(item))
+		}
+		pages = append(pages, ids)
+
+		next = ""
+		if cursor := recorder.Header().Get(NextCursorHeader); cursor != "" {
+			next = target + "&cursor=" + cursor
+		}
+		if len(pages) > 10 {
+			t.Fatalf("GET %s: too many pages %v", target, pages)
+		}
+	}
+	return pages
+}
+
+func commandLogID(commandLog *CommandLogRequest) int { return commandLog.ID }
+
+func commandCodeID(code CommandCodeRequest) int { return code.ID }
+
+func TestCommandLogPages(t *testing.T) {
+	handler, storage := newTestServer(t)
+	for _, commands := range [][]string{{"UP"}, {"UP", "DOWN"}, {"DOWN"}, {"LEFT"}, {"UP", "LEFT"}} {
+		postCommandLog(t, handler, commands...)
+	}
+	// one log per day, from 2024-01-01
+	for i, commandLog := range storage.commandLogs {
+		commandLog.Timestamp = time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		target string
+		want   [][]int
+	}{
+		{target: "/commands?limit=2", want: [][]int{{1, 2}, {3, 4}, {5}}},
+		{target: "/commands?limit=5", want: [][]int{{1, 2, 3, 4, 5}}},
+		{target: "/commands?limit=2&order=desc", want: [][]int{{5, 4}, {3, 2}, {1}}},
+		{target: "/commands?limit=2&command=UP", want: [][]int{{1, 2}, {5}}},
+		{target: "/commands?limit=1&command=DOWN&order=desc", want: [][]int{{3}, {2}}},
+		{target: "/commands?limit=10&command=GRAB", want: [][]int{{}}},
+		// from is inclusive, to is exclusive
+		{target: "/commands?limit=2&from=2024-01-02T00:00:00Z&to=2024-01-05T00:00:00Z", want: [][]int{{2, 3}, {4}}},
+		// the offset is taken into account
+		{target: "/commands?limit=10&from=2024-01-03T01:00:00%2B02:00", want: [][]int{{3, 4, 5}}},
+	}
+
+	for _, tt := range tests {
+		if got := getAllPages(t, handler, tt.target, commandLogID); !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("GET %s: pages %v, want %v", tt.target, got, tt.want)
+		}
+	}
+
+	// without ?limit= all logs fit into the default page
+	if got := getAllPages(t, handler, "/commands?order=asc", commandLogID); !slices.EqualFunc(got, [][]int{{1, 2, 3, 4, 5}}, slices.Equal) {
+		t.Fatalf("GET /commands: pages %v, want all logs on one page", got)
+	}
+}
+
+func TestCommandCodePages(t *testing.T) {
+	handler, _ := newTestServer(t)
+	postCommandLog(t, handler, "UP", "UP", "DOWN")
+	postCommandLog(t, handler, "UP", "LEFT", "LEFT", "DOWN")
+	// the codes are generated on the first request
+	doRequest(t, handler, "GET", "/commands/1/codes", "")
+	doRequest(t, handler, "GET", "/commands/2/codes", "")
+
+	tests := []struct {
+		target string
+		want   [][]int
+	}{
+		{target: "/allCommandCodes?limit=2", want: [][]int{{1, 2}, {3, 4}, {5}}},
+		{target: "/allCommandCodes?limit=2&order=desc", want: [][]int{{5, 4}, {3, 2}, {1}}},
+		{target: "/allCommandCodes?limit=2&commandLogId=2", want: [][]int{{3, 4}, {5}}},
+		{target: "/allCommandCodes?limit=1&command=UP", want: [][]int{{codeID(t, handler, 1, "UP")}, {codeID(t, handler, 2, "UP")}}},
+		{target: "/allCommandCodes?limit=10&commandLogId=1&command=LEFT", want: [][]int{{}}},
+	}
+
+	for _, tt := range tests {
+		if got := getAllPages(t, handler, tt.target, commandCodeID); !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("GET %s: pages %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+// codeID returns the id of the stored code of the command
+func codeID(t *testing.T, handler http.Handler, commandLogID int, command string) int {
+	t.Helper()
+	target := "/allCommandCodes?commandLogId=" + strconv.Itoa(commandLogID) + "&command=" + command
+	codes := decodeResponse[[]CommandCodeRequest](t, doRequest(t, handler, "GET", target, ""), http.StatusOK)
+	if len(codes) != 1 {
+		t.Fatalf("GET %s = %+v, want one code", target, codes)
+	}
+	return codes[0].ID
+}
+
+func TestInvalidPageParams(t *testing.T) {
+	handler, _ := newTestServer(t)
+
+	tests := []struct {
+		target     string
+		wantFields []string
+	}{
+		{target: "/commands?limit=0", wantFields: []string{"limit"}},
+		{target: "/commands?limit=1001", wantFields: []string{"limit"}},
+		{target: "/commands?limit=ten", wantFields: []string{"limit"}},
+		{target: "/commands?cursor=0", wantFields: []string{"cursor"}},
+		{target: "/commands?cursor=abc", wantFields: []string{"cursor"}},
+		{target: "/commands?order=newest", wantFields: []string{"order"}},
+		{target: "/commands?from=2024-01-01", wantFields: []string{"from"}},
+		{target: "/commands?to=yesterday", wantFields: []string{"to"}},
+		// all invalid parameters are reported at once
+		{target: "/commands?limit=-1&order=up&to=now", wantFields: []string{"limit", "order", "to"}},
+		{target: "/allCommandCodes?commandLogId=-1", wantFields: []string{"commandLogId"}},
+		{target: "/allCommandCodes?commandLogId=x&limit=0", wantFields: []string{"limit", "commandLogId"}},
+	}
+
+	for _, tt := range tests {
+		apiErr := decodeResponse[APIError](t, doRequest(t, handler, "GET", tt.target, ""), http.StatusBadRequest)
+		var fields []string
+		for _, fieldErr := range apiErr.Errors {
+			fields = append(fields, fieldErr.Field)
+		}
+		if apiErr.Code != CodeValidationFailed || !slices.Equal(fields, tt.wantFields) {
+			t.Errorf("GET %s: code %q, field errors %+v, want fields %v", tt.target, apiErr.Code, apiErr.Errors, tt.wantFields)
+		}
+	}
+}
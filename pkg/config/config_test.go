@@ -0,0 +1,213 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envNames are the variables read by Load, they are unset for the tests
+var envNames = []string{
+	"CONFIG_FILE", "LISTEN_ADDRESS", "CODING_ALGORITHM", "MAX_CODE_LENGTH",
+	"STORAGE_BACKEND", "STORAGE_READ_TIMEOUT", "STORAGE_WRITE_TIMEOUT", "STORAGE_CLEAN_TIMEOUT",
+	"DATABASE_URL", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_HOST", "DB_PORT", "PGSSLMODE",
+	"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_CONN_MAX_IDLE_TIME",
+	"BOLT_PATH", "RETENTION_MAX_LOGS", "RETENTION_MAX_AGE", "RETENTION_INTERVAL",
+	"HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT", "HTTP_MAX_HEADER_BYTES", "SHUTDOWN_TIMEOUT",
+	"LOG_LEVEL", "LOG_FORMAT",
+}
+
+// unsetEnv unsets the variables of the config, they are restored at the end of the test
+func unsetEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range envNames {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	unsetEnv(t)
+
+	cfg, args, err := Load(nil, nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := Default(); *cfg != *want {
+		t.Fatalf("Load = %+v, want the defaults %+v", cfg, want)
+	}
+	if len(args) != 0 {
+		t.Fatalf("args = %v, want none", args)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	unsetEnv(t)
+
+	configFile := writeConfigFile(t, `
+listenAddress: ":2000"
+coding:
+  maxCodeLength: 6
+postgres:
+  user: file-user
+retention:
+  maxAge: 24h
+`)
+	dotEnv := map[string]string{
+		"LISTEN_ADDRESS":  ":1000",
+		"MAX_CODE_LENGTH": "5",
+		"DB_USER":         "dotenv-user",
+		"DB_HOST":         "dotenv-host",
+		"STORAGE_BACKEND": "memory",
+	}
+	t.Setenv("MAX_CODE_LENGTH", "7")
+	t.Setenv("RETENTION_MAX_AGE", "1h")
+
+	cfg, args, err := Load([]string{"-config", configFile, "-max-code-length", "8", "migrate", "up"}, dotEnv)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		// each layer overrides the previous: defaults, .env, config file, env, flags
+		{name: "set only in .env", got: cfg.Postgres.Host, want: "dotenv-host"},
+		{name: "config file over .env", got: cfg.ListenAddress, want: ":2000"},
+		{name: "config file over .env", got: cfg.Postgres.User, want: "file-user"},
+		{name: "env over config file", got: cfg.Retention.MaxAge, want: time.Hour},
+		{name: "flag over env", got: cfg.Coding.MaxCodeLength, want: 8},
+		{name: "backend from .env", got: cfg.Storage.Backend, want: "memory"},
+		{name: "default", got: cfg.Retention.MaxLogs, want: 100},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if want := []string{"migrate", "up"}; !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestLoadConfigFileName(t *testing.T) {
+	unsetEnv(t)
+	dotEnvFile := writeConfigFile(t, `listenAddress: ":1000"`)
+	envFile := writeConfigFile(t, `listenAddress: ":2000"`)
+	flagFile := writeConfigFile(t, `listenAddress: ":3000"`)
+	dotEnv := map[string]string{"CONFIG_FILE": dotEnvFile}
+
+	if cfg, _, err := Load(nil, dotEnv); err != nil || cfg.ListenAddress != ":1000" {
+		t.Fatalf("CONFIG_FILE from .env: got %+v, %v, want listen address :1000", cfg, err)
+	}
+
+	t.Setenv("CONFIG_FILE", envFile)
+	if cfg, _, err := Load(nil, dotEnv); err != nil || cfg.ListenAddress != ":2000" {
+		t.Fatalf("CONFIG_FILE from env: got %+v, %v, want listen address :2000", cfg, err)
+	}
+
+	if cfg, _, err := Load([]string{"-config", flagFile}, dotEnv); err != nil || cfg.ListenAddress != ":3000" {
+		t.Fatalf("-config: got %+v, %v, want listen address :3000", cfg, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		env        map[string]string
+		dotEnv     map[string]string
+		args       []string
+		// parts of the error message
+		want []string
+	}{
+		{
+			name:       "unknown option in the config file",
+			configFile: "coding:\n  maxCodelength: 4\n",
+			want:       []string{"maxCodelength"},
+		},
+		{
+			name: "missing config file",
+			args: []string{"-config", "does-not-exist.yaml"},
+			want: []string{"config file", "does-not-exist.yaml"},
+		},
+		{
+			name: "invalid env variables are reported at once",
+			env:  map[string]string{"DB_PORT": "postgres", "RETENTION_MAX_AGE": "1 day", "LOG_LEVEL": "loud"},
+			want: []string{"DB_PORT", "RETENTION_MAX_AGE", "LOG_LEVEL"},
+		},
+		{
+			name:   "invalid .env variable",
+			dotEnv: map[string]string{"MAX_CODE_LENGTH": "many"},
+			want:   []string{".env file", "MAX_CODE_LENGTH"},
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-port", "3000"},
+			want: []string{"-port"},
+		},
+		{
+			name: "invalid options are reported at once",
+			env:  map[string]string{"STORAGE_BACKEND": "mysql", "CODING_ALGORITHM": "arithmetic", "LOG_FORMAT": "xml"},
+			args: []string{"-listen", "3000", "-max-code-length", "65"},
+			want: []string{"listenAddress", "coding.algorithm", "coding.maxCodeLength", "storage.backend", "log.format"},
+		},
+		{
+			name:       "bolt without a path",
+			configFile: "bolt:\n  path: \"\"\n",
+			args:       []string{"-storage", "bolt"},
+			want:       []string{"bolt.path"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.configFile != "" {
+				args = append([]string{"-config", writeConfigFile(t, tt.configFile)}, args...)
+			}
+
+			_, _, err := Load(args, tt.dotEnv)
+			if err == nil {
+				t.Fatalf("Load: got no error, want one about %v", tt.want)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("error %q doesn't mention %q", err, part)
+				}
+			}
+		})
+	}
+}
+
+func TestConnString(t *testing.T) {
+	cfg := PostgresConfig{User: "robot", Password: `it's a \secret`, Name: "commands", Host: "db", Port: 5433, SSLMode: "require"}
+	want := `user='robot' password='it\'s a \\secret' dbname='commands' sslmode='require' host='db' port=5433`
+	if got := cfg.ConnString(); got != want {
+		t.Fatalf("ConnString = %s, want %s", got, want)
+	}
+
+	cfg.DSN = "postgres://robot@db/commands"
+	if got := cfg.ConnString(); got != cfg.DSN {
+		t.Fatalf("ConnString with a DSN = %s, want the DSN", got)
+	}
+}
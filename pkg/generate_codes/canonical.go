@@ -0,0 +1,170 @@
+package generate_codes
+
+import (
+	"sort"
+	"strings"
+)
+
+// Canonical Huffman codes.
+// The tree walk in generateHuffmanCodesIterative gives codes that depend on the shape of the tree,
+// and the shape depends on the order in which equal frequencies come out of the heap.
+// Only the code lengths really matter for compression, so the canonical mode keeps the lengths
+// from the tree and assigns the bit patterns again in a fixed order (length, then command):
+//  - the first code is all zeros,
+//  - every next code is the previous code + 1,
+//  - when the length grows, the code is shifted left (zeros appended).
+// This way the whole codebook can be described by a list of (command, length) pairs
+// and the decoder does not need the tree.
+
+// SymbolCodeLength represents one entry of a canonical codebook of symbols of type S
+type SymbolCodeLength[S comparable] struct {
+	Command S   `json:"command"`
+	Length  int `json:"length"`
+}
+
+// CodeLength represents one entry of a canonical codebook
+type CodeLength = SymbolCodeLength[string]
+
+// GetCodeLengthsFromTree returns the depth of every leaf of the Huffman tree
+// returns map/hash table with {key="command", value=length}
+func GetCodeLengthsFromTree[S comparable, W Weight](root *SymbolNode[S, W]) map[S]int {
+	lengths := make(map[S]int)
+	if root == nil {
+		return lengths
+	}
+
+	// Only one distinct command - the root is a leaf, but a code needs at least one bit
+	if root.Left == nil && root.Right == nil {
+		lengths[root.Value] = 1
+		return lengths
+	}
+
+	// iterative traversal - the same reason as in generateHuffmanCodesIterative
+	stack := []*SymbolNode[S, W]{root}
+	depthStack := []int{0}
+
+	for len(stack) > 0 {
+		node, depth := stack[len(stack)-1], depthStack[len(depthStack)-1]
+		stack, depthStack = stack[:len(stack)-1], depthStack[:len(depthStack)-1]
+
+		if node == nil {
+			continue
+		}
+
+		if node.Left == nil && node.Right == nil {
+			lengths[node.Value] = depth
+			continue
+		}
+
+		stack = append(stack, node.Right, node.Left)
+		depthStack = append(depthStack, depth+1, depth+1)
+	}
+
+	return lengths
+}
+
+// SortCodeLengths returns code lengths in canonical order (length, then command)
+func SortCodeLengths(lengths map[string]int) []CodeLength {
+	return SortCodeLengthsFunc(lengths, strings.Compare)
+}
+
+// SortCodeLengthsFunc returns code lengths in canonical order (length, then symbol ordered by compare)
+func SortCodeLengthsFunc[S comparable](lengths map[S]int, compare func(a, b S) int) []SymbolCodeLength[S] {
+	codeLengths := make([]SymbolCodeLength[S], 0, len(lengths))
+	for symbol, length := range lengths {
+		codeLengths = append(codeLengths, SymbolCodeLength[S]{Command: symbol, Length: length})
+	}
+
+	sort.Slice(codeLengths, func(i, j int) bool {
+		if codeLengths[i].Length != codeLengths[j].Length {
+			return codeLengths[i].Length < codeLengths[j].Length
+		}
+		return compare(codeLengths[i].Command, codeLengths[j].Command) < 0
+	})
+
+	return codeLengths
+}
+
+// GetCanonicalCodesFromCodeLengths assigns canonical codes to the list of (command, length) pairs
+// The list does not have to be sorted - it is sorted in canonical order first.
+// returns map/hash table with {key="command", value="code"}
+func GetCanonicalCodesFromCodeLengths(codeLengths []CodeLength) map[string]string {
+	return GetCanonicalCodesFromCodeLengthsFunc(codeLengths, strings.Compare)
+}
+
+// GetCanonicalCodesFromCodeLengthsFunc assigns canonical codes to the list of (symbol, length) pairs,
+// symbols with the same length are ordered by compare
+// returns map/hash table with {key=symbol, value="code"}
+func GetCanonicalCodesFromCodeLengthsFunc[S comparable](codeLengths []SymbolCodeLength[S], compare func(a, b S) int) map[S]string {
+	lengths := make(map[S]int, len(codeLengths))
+	for _, cl := range codeLengths {
+		lengths[cl.Command] = cl.Length
+	}
+	sorted := SortCodeLengthsFunc(lengths, compare)
+
+	codes := make(map[S]string, len(sorted))
+	// code is kept as a slice of bits, so there is no limit of 64 bits like with uint64
+	var code []byte
+	for i, cl := range sorted {
+		if i > 0 {
+			code = incrementBits(code)
+		}
+		// shift left when the code gets longer
+		for len(code) < cl.Length {
+			code = append(code, '0')
+		}
+		codes[cl.Command] = string(code)
+	}
+
+	return codes
+}
+
+// incrementBits adds 1 to the binary number stored as a slice of '0' and '1'
+func incrementBits(code []byte) []byte {
+	result := append([]byte(nil), code...)
+	for i := len(result) - 1; i >= 0; i-- {
+		if result[i] == '0' {
+			result[i] = '1'
+			return result
+		}
+		result[i] = '0'
+	}
+	// all ones - can't happen for lengths taken from a valid prefix tree
+	return append([]byte{'1'}, result...)
+}
+
+// GetCanonicalCodeLengthsFromListOfCommands builds the Huffman tree for the commands
+// and returns the codebook as (command, length) pairs in canonical order
+func GetCanonicalCodeLengthsFromListOfCommands(commands []string) []CodeLength {
+	return GetCanonicalCodeLengthsFromListOfSymbols(commands, strings.Compare)
+}
+
+// GetCanonicalCodeLengthsFromListOfSymbols builds the Huffman tree for the symbols of any type
+// and returns the codebook as (symbol, length) pairs in canonical order
+func GetCanonicalCodeLengthsFromListOfSymbols[S comparable](symbols []S, compare func(a, b S) int) []SymbolCodeLength[S] {
+	if len(symbols) == 0 {
+		return nil
+	}
+
+	pq := InitializeHeapFunc(countFrequencies(symbols), compare)
+	root := BuildHuffmanTree(pq)
+
+	return SortCodeLengthsFunc(GetCodeLengthsFromTree(root), compare)
+}
+
+// GetCanonicalCodesFromListOfCommands generates canonical Huffman codes for a given list of commands
+// The codes depend only on the code lengths, so they don't change with the order of the tree walk.
+// returns map/hash table with {key="command", value="code"}
+func GetCanonicalCodesFromListOfCommands(commands []string) map[string]string {
+	return GetCanonicalCodesFromListOfSymbols(commands, strings.Compare)
+}
+
+// GetCanonicalCodesFromListOfSymbols generates canonical Huffman codes for a given list of symbols of any type
+// returns map/hash table with {key=symbol, value="code"}
+func GetCanonicalCodesFromListOfSymbols[S comparable](symbols []S, compare func(a, b S) int) map[S]string {
+	if len(symbols) == 0 {
+		return nil
+	}
+
+	return GetCanonicalCodesFromCodeLengthsFunc(GetCanonicalCodeLengthsFromListOfSymbols(symbols, compare), compare)
+}
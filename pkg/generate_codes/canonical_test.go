@@ -0,0 +1,107 @@
+package generate_codes
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetCanonicalCodesFromCodeLengths(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths map[string]int
+		want    map[string]string
+	}{
+		{name: "empty", lengths: map[string]int{}, want: map[string]string{}},
+		{name: "single command", lengths: map[string]int{"UP": 1}, want: map[string]string{"UP": "0"}},
+		{
+			// the example of RFC 1951 (DEFLATE), section 3.2.2
+			name:    "rfc 1951",
+			lengths: map[string]int{"A": 3, "B": 3, "C": 3, "D": 3, "E": 3, "F": 2, "G": 4, "H": 4},
+			want: map[string]string{"F": "00", "A": "010", "B": "011", "C": "100", "D": "101", "E": "110",
+				"G": "1110", "H": "1111"},
+		},
+		{
+			// commands of the same length get codes in the order of the commands, not of the input
+			name:    "same length",
+			lengths: map[string]int{"UP": 2, "DOWN": 2, "LEFT": 2, "RIGHT": 2},
+			want:    map[string]string{"DOWN": "00", "LEFT": "01", "RIGHT": "10", "UP": "11"},
+		},
+		{
+			// the code is shifted by more than one bit when lengths are skipped
+			name:    "skipped lengths",
+			lengths: map[string]int{"e": 3, "d": 3, "c": 3, "b": 3, "a": 1},
+			want:    map[string]string{"a": "0", "b": "100", "c": "101", "d": "110", "e": "111"},
+		},
+		{
+			name:    "unary",
+			lengths: map[string]int{"A": 1, "B": 2, "C": 3, "D": 4, "E": 4},
+			want:    map[string]string{"A": "0", "B": "10", "C": "110", "D": "1110", "E": "1111"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// reversed canonical order, so the function has to sort
+			codeLengths := SortCodeLengths(tt.lengths)
+			slices.Reverse(codeLengths)
+
+			got := GetCanonicalCodesFromCodeLengths(codeLengths)
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("GetCanonicalCodesFromCodeLengths(%v) = %v, want %v", codeLengths, got, tt.want)
+			}
+			if !IsCanonical(got) {
+				t.Fatalf("IsCanonical(%v) = false", got)
+			}
+		})
+	}
+}
+
+func TestSortCodeLengths(t *testing.T) {
+	got := SortCodeLengths(map[string]int{"UP": 3, "LEFT": 1, "GRAB": 3, "BACK": 2, "DROP": 3})
+	want := []CodeLength{{"LEFT", 1}, {"BACK", 2}, {"DROP", 3}, {"GRAB", 3}, {"UP", 3}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("SortCodeLengths = %v, want %v", got, want)
+	}
+}
+
+func TestGetCanonicalCodesFromListOfCommands(t *testing.T) {
+	commands := strings.Fields("LEFT LEFT GRAB LEFT BACK BACK LEFT UP RIGHT RIGHT RIGHT DROP LEFT")
+
+	// the lengths are the lengths of the tree-walk codes, only the bits differ
+	huffman := GetCodesFromListOfCommands(commands)
+	want := map[string]string{"LEFT": "00", "RIGHT": "01", "BACK": "100", "DROP": "101", "GRAB": "110", "UP": "111"}
+	for cmd, code := range want {
+		if len(huffman[cmd]) != len(code) {
+			t.Fatalf("the Huffman code of %q is %q, the canonical test code %q has another length", cmd, huffman[cmd], code)
+		}
+	}
+
+	if got := GetCanonicalCodesFromListOfCommands(commands); !maps.Equal(got, want) {
+		t.Fatalf("GetCanonicalCodesFromListOfCommands = %v, want %v", got, want)
+	}
+
+	wantLengths := []CodeLength{{"LEFT", 2}, {"RIGHT", 2}, {"BACK", 3}, {"DROP", 3}, {"GRAB", 3}, {"UP", 3}}
+	if got := GetCanonicalCodeLengthsFromListOfCommands(commands); !slices.Equal(got, wantLengths) {
+		t.Fatalf("GetCanonicalCodeLengthsFromListOfCommands = %v, want %v", got, wantLengths)
+	}
+}
+
+func TestIsCanonical(t *testing.T) {
+	tests := []struct {
+		codes map[string]string
+		want  bool
+	}{
+		{codes: map[string]string{"A": "0", "B": "10", "C": "11"}, want: true},
+		{codes: map[string]string{"A": "1", "B": "00", "C": "01"}, want: false},
+		// same length, but the codes are not in the order of the commands
+		{codes: map[string]string{"A": "0", "B": "11", "C": "10"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCanonical(tt.codes); got != tt.want {
+			t.Errorf("IsCanonical(%v) = %v, want %v", tt.codes, got, tt.want)
+		}
+	}
+}
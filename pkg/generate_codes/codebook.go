@@ -0,0 +1,288 @@
+package generate_codes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// Binary codebook format - a portable file with the whole codebook, so a decoder doesn't need the API.
+// All numbers are big endian, uvarint is the unsigned varint of encoding/binary.
+//
+//	magic           4 bytes  "HFCB"
+//	version         1 byte   CodebookVersion
+//	algorithm       1 byte   Algorithm
+//	max code length 1 byte   0 - no limit
+//	symbol count    uvarint
+//	symbols         symbol count times:
+//	  name length   uvarint
+//	  name          name length bytes (UTF-8)
+//	  code length   1 byte   1..MaxCodeLengthLimit
+//	  code          (code length + 7) / 8 bytes, MSB first - only for AlgorithmHuffman
+//	checksum        4 bytes  CRC-32 (IEEE) of all previous bytes
+//
+// Canonical codebooks store only the code lengths, with symbols in canonical order (length, then name) -
+// the codes are assigned again by GetCanonicalCodesFromCodeLengths. Other codebooks store the code bits too.
+
+// ErrInvalidCodebook is returned when the data is not a valid codebook
+var ErrInvalidCodebook = errors.New("invalid codebook")
+
+// ErrUnsupportedCodebookVersion is returned for codebooks written by a newer format version
+var ErrUnsupportedCodebookVersion = errors.New("unsupported codebook version")
+
+var codebookMagic = [4]byte{'H', 'F', 'C', 'B'}
+
+const CodebookVersion = 1
+
+// Algorithm says how the codes of a codebook were generated
+type Algorithm byte
+
+const (
+	// AlgorithmHuffman - codes from the tree walk, the code bits are stored
+	AlgorithmHuffman Algorithm = 1
+	// AlgorithmCanonical - canonical Huffman codes, only the code lengths are stored
+	AlgorithmCanonical Algorithm = 2
+	// AlgorithmLengthLimited - canonical codes with lengths from package-merge, only the code lengths are stored
+	AlgorithmLengthLimited Algorithm = 3
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmHuffman:
+		return "huffman"
+	case AlgorithmCanonical:
+		return "canonical"
+	case AlgorithmLengthLimited:
+		return "length-limited"
+	}
+	return fmt.Sprintf("Algorithm(%d)", byte(a))
+}
+
+func (a Algorithm) isCanonical() bool {
+	return a == AlgorithmCanonical || a == AlgorithmLengthLimited
+}
+
+// Codebook is the content of the binary codebook
+type Codebook struct {
+	Algorithm     Algorithm
+	MaxCodeLength int               // 0 - no limit
+	Codes         map[string]string // {key="command", value="code"}
+}
+
+// IsCanonical reports whether the codes are the canonical codes of their lengths
+func IsCanonical(codes map[string]string) bool {
+	codeLengths := make([]CodeLength, 0, len(codes))
+	for cmd, code := range codes {
+		codeLengths = append(codeLengths, CodeLength{Command: cmd, Length: len(code)})
+	}
+
+	canonical := GetCanonicalCodesFromCodeLengths(codeLengths)
+	for cmd, code := range codes {
+		if canonical[cmd] != code {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalCodebook writes the codebook in the binary format
+func MarshalCodebook(codebook Codebook) ([]byte, error) {
+	if codebook.MaxCodeLength < 0 || codebook.MaxCodeLength > MaxCodeLengthLimit {
+		return nil, fmt.Errorf("%w: max code length %d", ErrInvalidCodebook, codebook.MaxCodeLength)
+	}
+	switch codebook.Algorithm {
+	case AlgorithmHuffman, AlgorithmCanonical, AlgorithmLengthLimited:
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm %d", ErrInvalidCodebook, codebook.Algorithm)
+	}
+	// a decoder can't tell a bad codebook from a bad stream, so only valid codebooks are written
+	if _, err := BuildTreeFromCodes(codebook.Codes); err != nil {
+		return nil, err
+	}
+	if codebook.Algorithm.isCanonical() && !IsCanonical(codebook.Codes) {
+		return nil, fmt.Errorf("%w: codes are not canonical, use AlgorithmHuffman", ErrInvalidCodebook)
+	}
+
+	lengths := make(map[string]int, len(codebook.Codes))
+	for cmd, code := range codebook.Codes {
+		if len(code) > MaxCodeLengthLimit {
+			return nil, fmt.Errorf("%w: code of %q is longer than %d bits", ErrInvalidCodebook, cmd, MaxCodeLengthLimit)
+		}
+		lengths[cmd] = len(code)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(codebookMagic[:])
+	buf.WriteByte(CodebookVersion)
+	buf.WriteByte(byte(codebook.Algorithm))
+	buf.WriteByte(byte(codebook.MaxCodeLength))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(lengths))))
+
+	// canonical order for all algorithms, so the same codebook always gives the same bytes
+	for _, cl := range SortCodeLengths(lengths) {
+		buf.Write(binary.AppendUvarint(nil, uint64(len(cl.Command))))
+		buf.WriteString(cl.Command)
+		buf.WriteByte(byte(cl.Length))
+
+		if !codebook.Algorithm.isCanonical() {
+			code, _, err := EncodeCommands([]string{cl.Command}, codebook.Codes)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(code)
+		}
+	}
+
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+	return buf.Bytes(), nil
+}
+
+// codebookReader reads the fields of the format, the first error stops reading
+type codebookReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *codebookReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, fmt.Errorf("%w: unexpected end of data at byte %d", ErrInvalidCodebook, r.pos)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *codebookReader) byte() (byte, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *codebookReader) uvarint() (int, error) {
+	value, n := binary.Uvarint(r.data[r.pos:])
+	// every symbol needs at least 2 bytes, so larger numbers can't be valid
+	if n <= 0 || value > uint64(len(r.data)) {
+		return 0, fmt.Errorf("%w: invalid number at byte %d", ErrInvalidCodebook, r.pos)
+	}
+	r.pos += n
+	return int(value), nil
+}
+
+// UnmarshalCodebook reads the codebook written by MarshalCodebook
+func UnmarshalCodebook(data []byte) (Codebook, error) {
+	const headerSize, checksumSize = 7, 4
+	if len(data) < headerSize+checksumSize {
+		return Codebook{}, fmt.Errorf("%w: too short", ErrInvalidCodebook)
+	}
+	if !bytes.Equal(data[:4], codebookMagic[:]) {
+		return Codebook{}, fmt.Errorf("%w: bad magic number", ErrInvalidCodebook)
+	}
+	if data[4] != CodebookVersion {
+		return Codebook{}, fmt.Errorf("%w: %d", ErrUnsupportedCodebookVersion, data[4])
+	}
+
+	body, checksum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(checksum) {
+		return Codebook{}, fmt.Errorf("%w: checksum mismatch", ErrInvalidCodebook)
+	}
+
+	codebook := Codebook{
+		Algorithm:     Algorithm(data[5]),
+		MaxCodeLength: int(data[6]),
+	}
+	switch codebook.Algorithm {
+	case AlgorithmHuffman, AlgorithmCanonical, AlgorithmLengthLimited:
+	default:
+		return Codebook{}, fmt.Errorf("%w: unknown algorithm %d", ErrInvalidCodebook, codebook.Algorithm)
+	}
+
+	r := &codebookReader{data: body, pos: headerSize}
+	count, err := r.uvarint()
+	if err != nil {
+		return Codebook{}, err
+	}
+
+	codeLengths := make([]CodeLength, 0, count)
+	codes := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		nameLength, err := r.uvarint()
+		if err != nil {
+			return Codebook{}, err
+		}
+		name, err := r.bytes(nameLength)
+		if err != nil {
+			return Codebook{}, err
+		}
+		length, err := r.byte()
+		if err != nil {
+			return Codebook{}, err
+		}
+
+		cmd := string(name)
+		if _, ok := codes[cmd]; ok {
+			return Codebook{}, fmt.Errorf("%w: duplicate command %q", ErrInvalidCodebook, cmd)
+		}
+		if length == 0 || int(length) > MaxCodeLengthLimit {
+			return Codebook{}, fmt.Errorf("%w: code length %d of %q", ErrInvalidCodebook, length, cmd)
+		}
+		codeLengths = append(codeLengths, CodeLength{Command: cmd, Length: int(length)})
+
+		if codebook.Algorithm.isCanonical() {
+			codes[cmd] = ""
+			continue
+		}
+		code, err := r.bytes((int(length) + 7) / 8)
+		if err != nil {
+			return Codebook{}, err
+		}
+		codes[cmd] = FormatBits(code, int(length))
+	}
+	if r.pos != len(body) {
+		return Codebook{}, fmt.Errorf("%w: %d unexpected bytes after the symbols", ErrInvalidCodebook, len(body)-r.pos)
+	}
+
+	if codebook.Algorithm.isCanonical() {
+		if !kraftSumValid(codeLengths) {
+			return Codebook{}, fmt.Errorf("%w: code lengths don't form a prefix code", ErrInvalidCodebook)
+		}
+		codes = GetCanonicalCodesFromCodeLengths(codeLengths)
+	}
+	if _, err := BuildTreeFromCodes(codes); err != nil {
+		return Codebook{}, fmt.Errorf("%w: %w", ErrInvalidCodebook, err)
+	}
+
+	codebook.Codes = codes
+	return codebook, nil
+}
+
+// kraftSumValid checks the Kraft inequality (sum of 2^-length <= 1) - without it
+// the canonical codes would overflow and not be prefix-free
+func kraftSumValid(codeLengths []CodeLength) bool {
+	sorted := append([]CodeLength(nil), codeLengths...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Length > sorted[j].Length })
+
+	// sum in units of 2^-length of the longest code, halved when the length gets shorter,
+	// so the numbers stay small even for 64-bit codes
+	sum, length := uint64(0), 0
+	if len(sorted) > 0 {
+		length = sorted[0].Length
+	}
+	for _, cl := range sorted {
+		for length > cl.Length {
+			// round up - the space of longer codes is rounded up to a whole code of this length
+			sum = (sum + 1) / 2
+			length--
+		}
+		sum++
+	}
+	for length > 0 {
+		sum = (sum + 1) / 2
+		length--
+	}
+	return sum <= 1
+}
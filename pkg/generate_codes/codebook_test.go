@@ -0,0 +1,123 @@
+package generate_codes
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+var testCommands = strings.Fields("LEFT LEFT GRAB LEFT BACK BACK LEFT UP RIGHT RIGHT RIGHT DROP LEFT")
+
+// unaryCodes returns the codes "1", "01", "001", ... up to 64 bits, so the longest codes fit in the format
+func unaryCodes() map[string]string {
+	codes := make(map[string]string, MaxCodeLengthLimit+1)
+	for i := 0; i < MaxCodeLengthLimit; i++ {
+		codes[strings.Repeat("X", i+1)] = strings.Repeat("0", i) + "1"
+	}
+	codes["Z"] = strings.Repeat("0", MaxCodeLengthLimit)
+	return codes
+}
+
+func canonicalOf(codes map[string]string) map[string]string {
+	codeLengths := make([]CodeLength, 0, len(codes))
+	for cmd, code := range codes {
+		codeLengths = append(codeLengths, CodeLength{Command: cmd, Length: len(code)})
+	}
+	return GetCanonicalCodesFromCodeLengths(codeLengths)
+}
+
+func testCodebooks(t *testing.T) map[string]Codebook {
+	t.Helper()
+	lengthLimited, err := GetLengthLimitedCodesFromListOfCommands(testCommands, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Codebook{
+		"huffman":          {Algorithm: AlgorithmHuffman, Codes: GetCodesFromListOfCommands(testCommands)},
+		"canonical":        {Algorithm: AlgorithmCanonical, Codes: GetCanonicalCodesFromListOfCommands(testCommands)},
+		"length-limited":   {Algorithm: AlgorithmLengthLimited, MaxCodeLength: 3, Codes: lengthLimited},
+		"single command":   {Algorithm: AlgorithmHuffman, Codes: GetCodesFromListOfCommands([]string{"UP"})},
+		"64-bit huffman":   {Algorithm: AlgorithmHuffman, Codes: unaryCodes()},
+		"64-bit canonical": {Algorithm: AlgorithmLengthLimited, MaxCodeLength: MaxCodeLengthLimit, Codes: canonicalOf(unaryCodes())},
+		"unicode commands": {Algorithm: AlgorithmHuffman, Codes: map[string]string{"ŻÓŁW": "0", "→": "10", "": "11"}},
+	}
+}
+
+func TestCodebookRoundTrip(t *testing.T) {
+	for name, codebook := range testCodebooks(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := MarshalCodebook(codebook)
+			if err != nil {
+				t.Fatalf("MarshalCodebook: %v", err)
+			}
+			got, err := UnmarshalCodebook(data)
+			if err != nil {
+				t.Fatalf("UnmarshalCodebook: %v", err)
+			}
+			if got.Algorithm != codebook.Algorithm || got.MaxCodeLength != codebook.MaxCodeLength {
+				t.Fatalf("got %v max %d, want %v max %d", got.Algorithm, got.MaxCodeLength, codebook.Algorithm, codebook.MaxCodeLength)
+			}
+			if !maps.Equal(got.Codes, codebook.Codes) {
+				t.Fatalf("codes = %v, want %v", got.Codes, codebook.Codes)
+			}
+
+			again, err := MarshalCodebook(got)
+			if err != nil {
+				t.Fatalf("MarshalCodebook of the read codebook: %v", err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Fatalf("the same codebook gave different bytes")
+			}
+		})
+	}
+}
+
+func TestUnmarshalCodebookRejectsDamagedData(t *testing.T) {
+	for name, codebook := range testCodebooks(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := MarshalCodebook(codebook)
+			if err != nil {
+				t.Fatalf("MarshalCodebook: %v", err)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := UnmarshalCodebook(data[:n]); !errors.Is(err, ErrInvalidCodebook) {
+					t.Fatalf("truncated to %d of %d bytes: got %v, want %v", n, len(data), err, ErrInvalidCodebook)
+				}
+			}
+
+			for i := range data {
+				for bit := 0; bit < 8; bit++ {
+					damaged := bytes.Clone(data)
+					damaged[i] ^= 1 << bit
+					_, err := UnmarshalCodebook(damaged)
+					if !errors.Is(err, ErrInvalidCodebook) && !errors.Is(err, ErrUnsupportedCodebookVersion) {
+						t.Fatalf("bit %d of byte %d flipped: got %v, want an error", bit, i, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMarshalCodebookRejectsInvalidCodebooks(t *testing.T) {
+	tests := map[string]Codebook{
+		"not prefix-free":          {Algorithm: AlgorithmHuffman, Codes: map[string]string{"A": "0", "B": "01"}},
+		"not canonical":            {Algorithm: AlgorithmCanonical, Codes: map[string]string{"A": "1", "B": "0"}},
+		"unknown algorithm":        {Algorithm: 7, Codes: map[string]string{"A": "0", "B": "1"}},
+		"max code length":          {Algorithm: AlgorithmHuffman, MaxCodeLength: MaxCodeLengthLimit + 1, Codes: map[string]string{"A": "0"}},
+		"code longer than 64":      {Algorithm: AlgorithmHuffman, Codes: map[string]string{"A": "1", "B": strings.Repeat("0", MaxCodeLengthLimit+1)}},
+		"negative max code length": {Algorithm: AlgorithmHuffman, MaxCodeLength: -1, Codes: map[string]string{"A": "0"}},
+		"invalid code character":   {Algorithm: AlgorithmHuffman, Codes: map[string]string{"A": "0", "B": "1x"}},
+	}
+
+	for name, codebook := range tests {
+		t.Run(name, func(t *testing.T) {
+			if data, err := MarshalCodebook(codebook); err == nil {
+				t.Fatalf("MarshalCodebook(%v) = %x, want an error", codebook, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package generate_codes
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Decoding of the bitstream made by EncodeCommands.
+// There are two ways to decode:
+//  - tree walk - one bit at a time, go left for '0' and right for '1' until a leaf is reached,
+//    simple, but one step per bit,
+//  - lookup table - the next tableBits bits are used as an index to the table,
+//    so a whole code (or a few first levels of the tree for long codes) is consumed in one step.
+// Both return the same result, the table is faster for long streams.
+
+// ErrTruncatedInput is returned when the stream ends in the middle of a code
+var ErrTruncatedInput = errors.New("truncated input")
+
+// ErrInvalidPrefix is returned when the bits in the stream are not a prefix of any code
+var ErrInvalidPrefix = errors.New("invalid prefix")
+
+// ErrNotPrefixFree is returned when a code in the codebook is a prefix of another code
+var ErrNotPrefixFree = errors.New("codebook is not prefix-free")
+
+// DefaultTableBits is the number of bits used to index the lookup table
+const DefaultTableBits = 8
+
+// BuildTreeFromCodes rebuilds the tree from the codebook
+// codebook is a map/hash table with {key="command", value="code"}
+// Frequencies are not known, so they are left as 0.
+func BuildTreeFromCodes(codebook map[string]string) (*Node, error) {
+	root := &Node{}
+	// commands can be any strings (also empty), so leaves are marked here and not by the Value
+	leaves := make(map[*Node]bool, len(codebook))
+
+	for cmd, code := range codebook {
+		if code == "" {
+			return nil, fmt.Errorf("%w: empty code for command %q", ErrInvalidCode, cmd)
+		}
+
+		node := root
+		for i := 0; i < len(code); i++ {
+			if leaves[node] {
+				return nil, fmt.Errorf("%w: code of %q is a prefix of %q", ErrNotPrefixFree, node.Value, cmd)
+			}
+
+			var next **Node
+			switch code[i] {
+			case '0':
+				next = &node.Left
+			case '1':
+				next = &node.Right
+			default:
+				return nil, fmt.Errorf("%w: %q for command %q", ErrInvalidCode, code, cmd)
+			}
+
+			if *next == nil {
+				*next = &Node{}
+			}
+			node = *next
+		}
+
+		if node.Left != nil || node.Right != nil || leaves[node] {
+			return nil, fmt.Errorf("%w: code of %q is not unique or is a prefix of another code", ErrNotPrefixFree, cmd)
+		}
+		node.Value = cmd
+		leaves[node] = true
+	}
+
+	return root, nil
+}
+
+// bitAt returns the bit at position pos of the stream (the first bit is the MSB of the first byte)
+func bitAt(data []byte, pos int) byte {
+	return (data[pos/8] >> (7 - pos%8)) & 1
+}
+
+func checkBitLength(data []byte, bitLength int) error {
+	if bitLength < 0 || bitLength > len(data)*8 {
+		return fmt.Errorf("%w: bit length %d, but only %d bits of data", ErrTruncatedInput, bitLength, len(data)*8)
+	}
+	return nil
+}
+
+// DecodeWithTree decodes the first bitLength bits of data by walking the tree
+func DecodeWithTree(root *Node, data []byte, bitLength int) ([]string, error) {
+	if err := checkBitLength(data, bitLength); err != nil {
+		return nil, err
+	}
+	if root == nil || (root.Left == nil && root.Right == nil) {
+		// a tree with only the root can't decode anything - codes would be empty
+		return nil, fmt.Errorf("%w: tree has no codes", ErrInvalidCode)
+	}
+
+	return decodeWithTree(root, data, 0, bitLength)
+}
+
+// decodeWithTree decodes bits [from, bitLength) of data, positions in errors are counted from the start of data
+func decodeWithTree(root *Node, data []byte, from int, bitLength int) ([]string, error) {
+	var commands []string
+	node := root
+	codeStart := from
+	for pos := from; pos < bitLength; pos++ {
+		if bitAt(data, pos) == 0 {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+
+		if node == nil {
+			return nil, fmt.Errorf("%w at bit %d", ErrInvalidPrefix, codeStart)
+		}
+
+		// Leaf - the command is found, start again from the root
+		if node.Left == nil && node.Right == nil {
+			commands = append(commands, node.Value)
+			node = root
+			codeStart = pos + 1
+		}
+	}
+
+	if node != root {
+		return nil, fmt.Errorf("%w: incomplete code at bit %d", ErrTruncatedInput, codeStart)
+	}
+
+	return commands, nil
+}
+
+// tableEntry says what to do with the next tableBits bits of the stream
+type tableEntry struct {
+	command string
+	length  int   // length of the code of the command, 0 if the code is longer than tableBits
+	node    *Node // for codes longer than tableBits - node to continue the tree walk from
+}
+
+// DecodingTable is a lookup table for decoding tableBits bits at a time
+type DecodingTable struct {
+	root      *Node
+	tableBits int
+	entries   []tableEntry
+}
+
+// NewDecodingTable builds the lookup table for the codebook
+// tableBits is the number of bits used as an index, the table has 2^tableBits entries
+func NewDecodingTable(codebook map[string]string, tableBits int) (*DecodingTable, error) {
+	if tableBits < 1 || tableBits > 16 {
+		return nil, fmt.Errorf("table bits must be between 1 and 16, got %d", tableBits)
+	}
+
+	root, err := BuildTreeFromCodes(codebook)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &DecodingTable{
+		root:      root,
+		tableBits: tableBits,
+		entries:   make([]tableEntry, 1<<tableBits),
+	}
+
+	// Every index is a possible value of the next tableBits bits - walk the tree with them
+	for index := range table.entries {
+		node := root
+		for bit := 0; bit < tableBits; bit++ {
+			if (index>>(tableBits-1-bit))&1 == 0 {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+
+			if node == nil {
+				// invalid prefix - entry stays empty
+				break
+			}
+			if node.Left == nil && node.Right == nil {
+				table.entries[index] = tableEntry{command: node.Value, length: bit + 1}
+				break
+			}
+		}
+
+		if node != nil && (node.Left != nil || node.Right != nil) {
+			table.entries[index] = tableEntry{node: node}
+		}
+	}
+
+	return table, nil
+}
+
+// peekBits returns the next n bits from pos as a number, bits after the end of the stream are zeros
+func peekBits(data []byte, bitLength int, pos int, n int) int {
+	value := 0
+	for i := 0; i < n; i++ {
+		value <<= 1
+		if pos+i < bitLength {
+			value |= int(bitAt(data, pos+i))
+		}
+	}
+	return value
+}
+
+// Decode decodes the first bitLength bits of data using the lookup table
+func (t *DecodingTable) Decode(data []byte, bitLength int) ([]string, error) {
+	if err := checkBitLength(data, bitLength); err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	pos := 0
+	for pos < bitLength {
+		entry := t.entries[peekBits(data, bitLength, pos, t.tableBits)]
+
+		// Short code - the whole code is in the table
+		if entry.length > 0 {
+			if pos+entry.length > bitLength {
+				return nil, fmt.Errorf("%w: incomplete code at bit %d", ErrTruncatedInput, pos)
+			}
+			commands = append(commands, entry.command)
+			pos += entry.length
+			continue
+		}
+
+		if entry.node == nil {
+			// Near the end of the stream the index is padded with zeros, so the invalid prefix
+			// may come from the padding - the tree walk on the real bits tells what is wrong
+			if bitLength-pos < t.tableBits {
+				if _, err := decodeWithTree(t.root, data, pos, bitLength); err != nil {
+					return nil, err
+				}
+			}
+			return nil, fmt.Errorf("%w at bit %d", ErrInvalidPrefix, pos)
+		}
+
+		// Long code - the first tableBits bits are consumed, continue with the tree walk
+		codeStart := pos
+		if pos+t.tableBits > bitLength {
+			return nil, fmt.Errorf("%w: incomplete code at bit %d", ErrTruncatedInput, codeStart)
+		}
+		pos += t.tableBits
+		node := entry.node
+		for node.Left != nil || node.Right != nil {
+			if pos >= bitLength {
+				return nil, fmt.Errorf("%w: incomplete code at bit %d", ErrTruncatedInput, codeStart)
+			}
+			if bitAt(data, pos) == 0 {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+			pos++
+			if node == nil {
+				return nil, fmt.Errorf("%w at bit %d", ErrInvalidPrefix, codeStart)
+			}
+		}
+		commands = append(commands, node.Value)
+	}
+
+	return commands, nil
+}
+
+// DecodeCommands decodes the bitstream with the codebook using the lookup table
+// codebook is a map/hash table with {key="command", value="code"}
+func DecodeCommands(data []byte, bitLength int, codebook map[string]string) ([]string, error) {
+	table, err := NewDecodingTable(codebook, DefaultTableBits)
+	if err != nil {
+		return nil, err
+	}
+	return table.Decode(data, bitLength)
+}
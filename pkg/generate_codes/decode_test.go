@@ -0,0 +1,156 @@
+package generate_codes
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+var testTableBits = []int{1, 3, DefaultTableBits, 16}
+
+// randomCodebookCommands returns commands with skewed frequencies, so some codes are longer than the tables
+func randomCodebookCommands(rnd *rand.Rand) []string {
+	n := 1 + rnd.IntN(40)
+	var commands []string
+	for i := 0; i < n; i++ {
+		for j := 1 + rnd.IntN(1<<rnd.IntN(12)); j > 0; j-- {
+			commands = append(commands, fmt.Sprintf("cmd%d", i))
+		}
+	}
+	rnd.Shuffle(len(commands), func(i, j int) { commands[i], commands[j] = commands[j], commands[i] })
+	return commands
+}
+
+type testDecoder struct {
+	name   string
+	decode func(data []byte, bitLength int) ([]string, error)
+}
+
+func testDecoders(t *testing.T, codebook map[string]string) []testDecoder {
+	t.Helper()
+	root, err := BuildTreeFromCodes(codebook)
+	if err != nil {
+		t.Fatalf("BuildTreeFromCodes(%v): %v", codebook, err)
+	}
+	decoders := []testDecoder{{name: "tree", decode: func(data []byte, bitLength int) ([]string, error) {
+		return DecodeWithTree(root, data, bitLength)
+	}}}
+	for _, tableBits := range testTableBits {
+		table, err := NewDecodingTable(codebook, tableBits)
+		if err != nil {
+			t.Fatalf("NewDecodingTable(%v, %d): %v", codebook, tableBits, err)
+		}
+		decoders = append(decoders, testDecoder{name: fmt.Sprintf("table %d bits", tableBits), decode: table.Decode})
+	}
+	return decoders
+}
+
+func TestTableDecodeMatchesTreeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(3, 4))
+
+	for trial := 0; trial < 200; trial++ {
+		commands := randomCodebookCommands(rnd)
+		codebook := GetCodesFromListOfCommands(commands)
+		if trial%2 == 1 {
+			codebook = GetCanonicalCodesFromListOfCommands(commands)
+		}
+		decoders := testDecoders(t, codebook)
+
+		// a short message, so every truncation can be checked
+		message := make([]string, rnd.IntN(20))
+		for i := range message {
+			message[i] = commands[rnd.IntN(len(commands))]
+		}
+		data, bitLength, err := EncodeCommands(message, codebook)
+		if err != nil {
+			t.Fatalf("EncodeCommands: %v", err)
+		}
+		// the bits after bitLength must be ignored
+		if bitLength%8 != 0 {
+			data[len(data)-1] |= 0xff >> (bitLength % 8)
+		}
+
+		// boundaries[i] is the bit where the i-th command starts
+		boundaries := []int{0}
+		for _, cmd := range message {
+			boundaries = append(boundaries, boundaries[len(boundaries)-1]+len(codebook[cmd]))
+		}
+
+		for _, decoder := range decoders {
+			got, err := decoder.decode(data, bitLength)
+			if err != nil || !slices.Equal(got, message) {
+				t.Fatalf("%s: decoded %v, %v, want %v (codebook %v)", decoder.name, got, err, message, codebook)
+			}
+
+			for cut := 0; cut < bitLength; cut++ {
+				got, err := decoder.decode(data[:(cut+7)/8], cut)
+				if i := slices.Index(boundaries, cut); i >= 0 {
+					if err != nil || !slices.Equal(got, message[:i]) {
+						t.Fatalf("%s: %d bits decoded %v, %v, want %v", decoder.name, cut, got, err, message[:i])
+					}
+					continue
+				}
+				if !errors.Is(err, ErrTruncatedInput) {
+					t.Fatalf("%s: %d of %d bits decoded %v, %v, want %v", decoder.name, cut, bitLength, got, err, ErrTruncatedInput)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	// "11" is not a prefix of any code
+	codebook := map[string]string{"A": "0", "B": "10"}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		bitLength int
+		want      []string
+		wantErr   error
+	}{
+		{name: "empty", data: nil, bitLength: 0},
+		{name: "valid", data: []byte{0b01000000}, bitLength: 3, want: []string{"A", "B"}},
+		{name: "incomplete code", data: []byte{0b01000000}, bitLength: 2, wantErr: ErrTruncatedInput},
+		{name: "invalid prefix at the end", data: []byte{0b01100000}, bitLength: 3, wantErr: ErrInvalidPrefix},
+		{name: "invalid prefix", data: []byte{0b11000000, 0}, bitLength: 16, wantErr: ErrInvalidPrefix},
+		{name: "bit length longer than data", data: []byte{0}, bitLength: 9, wantErr: ErrTruncatedInput},
+		{name: "negative bit length", data: []byte{0}, bitLength: -1, wantErr: ErrTruncatedInput},
+	}
+
+	for _, decoder := range testDecoders(t, codebook) {
+		for _, tt := range tests {
+			t.Run(decoder.name+"/"+tt.name, func(t *testing.T) {
+				got, err := decoder.decode(tt.data, tt.bitLength)
+				if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if err == nil && !slices.Equal(got, tt.want) {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestBuildTreeFromCodesRejectsInvalidCodebooks(t *testing.T) {
+	tests := map[string]struct {
+		codebook map[string]string
+		wantErr  error
+	}{
+		"prefix":       {codebook: map[string]string{"A": "0", "B": "01"}, wantErr: ErrNotPrefixFree},
+		"same code":    {codebook: map[string]string{"A": "0", "B": "0"}, wantErr: ErrNotPrefixFree},
+		"empty code":   {codebook: map[string]string{"A": ""}, wantErr: ErrInvalidCode},
+		"invalid bits": {codebook: map[string]string{"A": "0", "B": "12"}, wantErr: ErrInvalidCode},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := BuildTreeFromCodes(tt.codebook); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BuildTreeFromCodes(%v) = %v, want %v", tt.codebook, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package generate_codes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encoding of the whole command sequence.
+// Codes of the commands are concatenated in the order of the commands and packed into bytes.
+// Bit order: the first bit of the stream is the most significant bit of the first byte,
+// so the stream "0101 1" is packed as 0b01011000 - the unused bits of the last byte are zeros.
+// The decoder needs the bit length to know where the stream ends.
+
+// ErrUnknownCommand is returned when the command has no code in the codebook
+var ErrUnknownCommand = errors.New("command not in codebook")
+
+// ErrInvalidCode is returned when the code in the codebook is not a string of '0' and '1'
+var ErrInvalidCode = errors.New("invalid code in codebook")
+
+// EncodeCommands packs codes of the commands into a bitstream
+// codebook is a map/hash table with {key="command", value="code"}
+// returns packed bytes and the number of bits used
+func EncodeCommands(commands []string, codebook map[string]string) ([]byte, int, error) {
+	bitLength := 0
+	for _, cmd := range commands {
+		code, ok := codebook[cmd]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %q", ErrUnknownCommand, cmd)
+		}
+		// an empty code would encode nothing and the command would be lost
+		if code == "" {
+			return nil, 0, fmt.Errorf("%w: empty code for command %q", ErrInvalidCode, cmd)
+		}
+		bitLength += len(code)
+	}
+
+	data := make([]byte, (bitLength+7)/8)
+	pos := 0
+	for _, cmd := range commands {
+		code := codebook[cmd]
+		for i := 0; i < len(code); i++ {
+			switch code[i] {
+			case '1':
+				data[pos/8] |= 0x80 >> (pos % 8)
+			case '0':
+			default:
+				return nil, 0, fmt.Errorf("%w: %q for command %q", ErrInvalidCode, code, cmd)
+			}
+			pos++
+		}
+	}
+
+	return data, bitLength, nil
+}
+
+// FormatBits returns the first bitLength bits of data as a string of '0' and '1' (for debugging)
+func FormatBits(data []byte, bitLength int) string {
+	bitLength = min(bitLength, len(data)*8)
+
+	var sb strings.Builder
+	sb.Grow(bitLength)
+	for pos := 0; pos < bitLength; pos++ {
+		if data[pos/8]&(0x80>>(pos%8)) != 0 {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+		}
+	}
+	return sb.String()
+}
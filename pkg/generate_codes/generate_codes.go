@@ -2,6 +2,8 @@ package generate_codes
 
 import (
 	"container/heap"
+	"sort"
+	"strings"
 )
 
 // NOTE: I acknowledge that there are many comments in the code. They are added to explain what is happening in each code snippet.
@@ -53,39 +55,75 @@ import (
 }
 */
 
-// Represents a node in the Huffman tree
-type Node struct {
-	Value       string
-	Frequency   int
-	Left, Right *Node
+// Symbols.
+// The commands are strings, but the algorithms work for any comparable symbol type
+// (e.g. integer opcodes, byte values or struct-typed commands), so the tree and the code generators
+// are generic over the symbol type S. The string functions (...ListOfCommands) are thin wrappers.
+// Map iteration order is random and comparable types have no order, so the generic functions
+// take a compare function (like slices.SortFunc, e.g. cmp.Compare[int]) - it must be a total order
+// of the symbols, it is used to keep the codes deterministic. Strings use strings.Compare.
+// The frequencies are of type W - counts (int) when they are counted from a list of symbols,
+// but also floats for probabilities (see weights.go).
+
+// Weight is the type of the frequencies - counts (integers) or probabilities (floats)
+type Weight interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// Represents a node in the Huffman tree of symbols of type S with weights of type W
+type SymbolNode[S comparable, W Weight] struct {
+	Value       S
+	Frequency   W
+	Left, Right *SymbolNode[S, W]
 	// The index is needed by update and is maintained by the heap.Interface methods.
 	index int // The index of the item in the heap.
+	// Used only to break ties between nodes with the same frequency (see SymbolQueue.Less)
+	depth   int // height of the subtree, 0 for a leaf
+	minRank int // smallest rank (position in the sorted symbols) of the values in the subtree
 }
 
+// Represents a node in the Huffman tree of commands
+type Node = SymbolNode[string, int]
+
+// SymbolQueue implements heap.Interface and holds SymbolNodes.
+type SymbolQueue[S comparable, W Weight] []*SymbolNode[S, W]
+
 // PriorityQueue implements heap.Interface and holds Nodes.
-type PriorityQueue []*Node
+type PriorityQueue = SymbolQueue[string, int]
 
-func (pq PriorityQueue) Len() int { return len(pq) }
+func (pq SymbolQueue[S, W]) Len() int { return len(pq) }
 
-func (pq PriorityQueue) Less(i, j int) bool {
+func (pq SymbolQueue[S, W]) Less(i, j int) bool {
 	//Pop should return the lowest priority/frequency (minimum heap), so use "less than" here.
-	return pq[i].Frequency < pq[j].Frequency
+	if pq[i].Frequency != pq[j].Frequency {
+		return pq[i].Frequency < pq[j].Frequency
+	}
+	// Ties are broken so the order is total - the same frequencies always give the same tree,
+	// no matter in which order the nodes were pushed to the heap.
+	// Shallower subtrees first - this also keeps the longest code as short as possible.
+	if pq[i].depth != pq[j].depth {
+		return pq[i].depth < pq[j].depth
+	}
+	// Subtrees have disjoint leaves, so the smallest rank is different for every node in the queue
+	return pq[i].minRank < pq[j].minRank
 }
 
-func (pq PriorityQueue) Swap(i, j int) {
+func (pq SymbolQueue[S, W]) Swap(i, j int) {
 	pq[i], pq[j] = pq[j], pq[i]
 	pq[i].index = i
 	pq[j].index = j
 }
 
-func (pq *PriorityQueue) Push(x interface{}) {
+func (pq *SymbolQueue[S, W]) Push(x interface{}) {
 	n := len(*pq)
-	item := x.(*Node)
+	item := x.(*SymbolNode[S, W])
 	item.index = n
 	*pq = append(*pq, item)
 }
 
-func (pq *PriorityQueue) Pop() interface{} {
+func (pq *SymbolQueue[S, W]) Pop() interface{} {
 	old := *pq
 	n := len(old)
 	item := old[n-1]
@@ -96,42 +134,78 @@ func (pq *PriorityQueue) Pop() interface{} {
 }
 
 // update modifies the priority and value of an Item in the queue.
-func (pq *PriorityQueue) update(item *Node, value string, priority int) {
+// The rank is not changed, so ties are broken in the same order as before.
+func (pq *SymbolQueue[S, W]) update(item *SymbolNode[S, W], value S, priority W) {
 	item.Value = value
 	item.Frequency = priority
 	heap.Fix(pq, item.index)
 }
 
+// countFrequencies counts the frequency of each symbol in the list
+func countFrequencies[S comparable](symbols []S) map[S]int {
+	frequencyMap := make(map[S]int)
+	for _, symbol := range symbols {
+		frequencyMap[symbol]++
+	}
+	return frequencyMap
+}
+
+// sortedSymbols returns the symbols of the frequency map sorted with compare
+func sortedSymbols[S comparable, W Weight](frequencyMap map[S]W, compare func(a, b S) int) []S {
+	symbols := make([]S, 0, len(frequencyMap))
+	for symbol := range frequencyMap {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return compare(symbols[i], symbols[j]) < 0
+	})
+	return symbols
+}
+
 // InitializeHeap initializes the priority queue (heap) properties
 func InitializeHeap(frequencyMap map[string]int) *PriorityQueue {
-	pq := make(PriorityQueue, len(frequencyMap))
-	i := 0
-	for str, freq := range frequencyMap {
-		pq[i] = &Node{
-			Value:     str,
-			Frequency: freq,
+	return InitializeHeapFunc(frequencyMap, strings.Compare)
+}
+
+// InitializeHeapFunc initializes the priority queue (heap) of symbols of any type,
+// compare orders the symbols to break ties between equal frequencies
+func InitializeHeapFunc[S comparable, W Weight](frequencyMap map[S]W, compare func(a, b S) int) *SymbolQueue[S, W] {
+	// Map iteration order is random, so fill the heap in sorted order
+	symbols := sortedSymbols(frequencyMap, compare)
+
+	pq := make(SymbolQueue[S, W], len(symbols))
+	for i, symbol := range symbols {
+		pq[i] = &SymbolNode[S, W]{
+			Value:     symbol,
+			Frequency: frequencyMap[symbol],
 			index:     i,
+			minRank:   i,
 		}
-		i++
 	}
 
 	heap.Init(&pq)
 	return &pq
 }
 
-// BuildHuffmanTree builds the Huffman tree
-func BuildHuffmanTree(pq *PriorityQueue) *Node {
+// BuildHuffmanTree builds the Huffman tree, nil for an empty queue
+func BuildHuffmanTree[S comparable, W Weight](pq *SymbolQueue[S, W]) *SymbolNode[S, W] {
+	if pq.Len() == 0 {
+		return nil
+	}
+
 	for pq.Len() > 1 { // when len is 1 -> this is the root node containing all subtrees => whole built tree
 		// Pop two nodes with the lowest frequencies
-		node1 := heap.Pop(pq).(*Node)
-		node2 := heap.Pop(pq).(*Node)
+		node1 := heap.Pop(pq).(*SymbolNode[S, W])
+		node2 := heap.Pop(pq).(*SymbolNode[S, W])
 
 		// Create a new node without value, with combined frequency and set its children
 		// left node (lowest freq) and right node (second lowest freq)
-		newNode := &Node{
+		newNode := &SymbolNode[S, W]{
 			Frequency: node1.Frequency + node2.Frequency,
 			Left:      node1,
 			Right:     node2,
+			depth:     max(node1.depth, node2.depth) + 1,
+			minRank:   min(node1.minRank, node2.minRank),
 		}
 
 		// Push the new node back to the heap so it will be treated as a regular node
@@ -146,7 +220,7 @@ func BuildHuffmanTree(pq *PriorityQueue) *Node {
 // generates Huffman codes for each string based on the Huffman tree
 // returns map/hash table with {key="command", value="code"}
 // this is recursive depth-first traversal/search (DFS)
-func generateHuffmanCodesRecursive(root *Node, code string, codes map[string]string) {
+func generateHuffmanCodesRecursive[S comparable, W Weight](root *SymbolNode[S, W], code string, codes map[S]string) {
 	if root == nil {
 		return
 	}
@@ -164,9 +238,19 @@ func generateHuffmanCodesRecursive(root *Node, code string, codes map[string]str
 
 // iterative traversal to avoid stack overflow - max number of input commands is not specified
 // returns map/hash table with {key="command", value="code"}
-func generateHuffmanCodesIterative(root *Node) map[string]string {
-	codes := make(map[string]string)
-	stack := []*Node{root}
+func generateHuffmanCodesIterative[S comparable, W Weight](root *SymbolNode[S, W]) map[S]string {
+	codes := make(map[S]string)
+	if root == nil {
+		return codes
+	}
+
+	// Only one distinct symbol - the root is a leaf, but a code needs at least one bit (see GetCodeLengthsFromTree)
+	if root.Left == nil && root.Right == nil {
+		codes[root.Value] = "0"
+		return codes
+	}
+
+	stack := []*SymbolNode[S, W]{root}
 	codeStack := []string{""}
 
 	for len(stack) > 0 {
@@ -192,8 +276,15 @@ func generateHuffmanCodesIterative(root *Node) map[string]string {
 // GetCodesFromListOfCommands generates Huffman codes for a given list of commands
 // Returns a slice of CommandCode, where each element contains a command and its code
 func GetCodesFromListOfCommands(commands []string) map[string]string {
+	return GetCodesFromListOfSymbols(commands, strings.Compare)
+}
+
+// GetCodesFromListOfSymbols generates Huffman codes for a given list of symbols of any type,
+// compare orders the symbols to break ties between equal frequencies
+// returns map/hash table with {key=symbol, value="code"}
+func GetCodesFromListOfSymbols[S comparable](symbols []S, compare func(a, b S) int) map[S]string {
 	// 1 get commands
-	if commands == nil {
+	if len(symbols) == 0 {
 		return nil
 	}
 
@@ -202,14 +293,11 @@ func GetCodesFromListOfCommands(commands []string) map[string]string {
 	//and then priority queue (min heap) utilized to take two elements with lowest frequencies
 	//in every step.
 
-	// Count the frequency of each string in the commands.
-	frequencyMap := make(map[string]int)
-	for _, cmd := range commands {
-		frequencyMap[cmd]++
-	}
+	// Count the frequency of each symbol in the list.
+	frequencyMap := countFrequencies(symbols)
 
 	// Initialize heap / priority queue
-	pq := InitializeHeap(frequencyMap)
+	pq := InitializeHeapFunc(frequencyMap, compare)
 
 	// Print frequency map (optional)
 	// fmt.Println("String | Frequency")
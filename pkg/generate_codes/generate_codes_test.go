@@ -0,0 +1,164 @@
+package generate_codes
+
+import (
+	"cmp"
+	"container/heap"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func reverseCompare(a, b int) int { return cmp.Compare(b, a) }
+
+func TestCodesFromListOfIntSymbols(t *testing.T) {
+	tests := []struct {
+		name          string
+		symbols       []int
+		compare       func(a, b int) int
+		wantCodes     map[int]string
+		wantCanonical map[int]string
+	}{
+		{
+			name:    "empty",
+			symbols: []int{},
+			compare: cmp.Compare[int],
+		},
+		{
+			name:          "single symbol",
+			symbols:       []int{7, 7, 7},
+			compare:       cmp.Compare[int],
+			wantCodes:     map[int]string{7: "0"},
+			wantCanonical: map[int]string{7: "0"},
+		},
+		{
+			// 1 and 2 are merged first (equal frequencies, the smaller symbol goes left),
+			// then 3 is merged with them - a leaf goes before a subtree of the same frequency
+			name:          "ties",
+			symbols:       []int{1, 2, 3, 3},
+			compare:       cmp.Compare[int],
+			wantCodes:     map[int]string{3: "0", 1: "10", 2: "11"},
+			wantCanonical: map[int]string{3: "0", 1: "10", 2: "11"},
+		},
+		{
+			name:          "ties in reverse order",
+			symbols:       []int{1, 2, 3, 3},
+			compare:       reverseCompare,
+			wantCodes:     map[int]string{3: "0", 2: "10", 1: "11"},
+			wantCanonical: map[int]string{3: "0", 2: "10", 1: "11"},
+		},
+		{
+			name:          "negative symbols",
+			symbols:       []int{-5, -5, -5, -5, 0, 0, 9, 100},
+			compare:       cmp.Compare[int],
+			wantCodes:     map[int]string{-5: "0", 0: "10", 9: "110", 100: "111"},
+			wantCanonical: map[int]string{-5: "0", 0: "10", 9: "110", 100: "111"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetCodesFromListOfSymbols(tt.symbols, tt.compare); !maps.Equal(got, tt.wantCodes) {
+				t.Errorf("GetCodesFromListOfSymbols(%v) = %v, want %v", tt.symbols, got, tt.wantCodes)
+			}
+			if got := GetCanonicalCodesFromListOfSymbols(tt.symbols, tt.compare); !maps.Equal(got, tt.wantCanonical) {
+				t.Errorf("GetCanonicalCodesFromListOfSymbols(%v) = %v, want %v", tt.symbols, got, tt.wantCanonical)
+			}
+		})
+	}
+}
+
+func TestTreeOfIntSymbols(t *testing.T) {
+	root := GetTreeFromListOfSymbols([]int{1, 2, 3, 3}, cmp.Compare[int])
+	if root == nil || root.Frequency != 4 {
+		t.Fatalf("root = %+v, want frequency 4", root)
+	}
+
+	want := "(4)\n|-- 0: 3 (2)\n`-- 1: (2)\n    |-- 0: 1 (1)\n    `-- 1: 2 (1)\n"
+	if got := TreeToText(root, nil); got != want {
+		t.Fatalf("TreeToText =\n%s\nwant\n%s", got, want)
+	}
+
+	lengths := GetCodeLengthsFromTree(root)
+	if want := map[int]int{3: 1, 1: 2, 2: 2}; !maps.Equal(lengths, want) {
+		t.Fatalf("GetCodeLengthsFromTree = %v, want %v", lengths, want)
+	}
+}
+
+func TestEqualFrequenciesGiveTheSameCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		want     map[string]string
+	}{
+		{
+			name:     "two pairs",
+			commands: strings.Fields("A B C D"),
+			want:     map[string]string{"A": "00", "B": "01", "C": "10", "D": "11"},
+		},
+		{
+			name:     "odd number of symbols",
+			commands: strings.Fields("A B C"),
+			want:     map[string]string{"C": "0", "A": "10", "B": "11"},
+		},
+		{
+			// the leaf C and the subtree of A and B have the same frequency - the leaf goes first
+			name:     "leaf and subtree",
+			commands: strings.Fields("A B C C"),
+			want:     map[string]string{"C": "0", "A": "10", "B": "11"},
+		},
+		{
+			name:     "eight symbols",
+			commands: strings.Fields("H G F E D C B A"),
+			want: map[string]string{"A": "000", "B": "001", "C": "010", "D": "011",
+				"E": "100", "F": "101", "G": "110", "H": "111"},
+		},
+		{
+			// BACK+GRAB (2), DOWN+LEFT (4), RIGHT+UP (4), then the two lightest: BACK+GRAB and DOWN+LEFT
+			name:     "ties on every level",
+			commands: strings.Fields("LEFT LEFT RIGHT RIGHT UP UP DOWN DOWN GRAB BACK"),
+			want: map[string]string{"RIGHT": "00", "UP": "01", "BACK": "100", "GRAB": "101",
+				"DOWN": "110", "LEFT": "111"},
+		},
+	}
+
+	rnd := rand.New(rand.NewPCG(5, 6))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := slices.Clone(tt.commands)
+			for run := 0; run < 200; run++ {
+				rnd.Shuffle(len(commands), func(i, j int) { commands[i], commands[j] = commands[j], commands[i] })
+				if got := GetCodesFromListOfCommands(commands); !maps.Equal(got, tt.want) {
+					t.Fatalf("run %d, commands %v: got %v, want %v", run, commands, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueOrderDoesNotDependOnPushOrder(t *testing.T) {
+	frequencyMap := map[string]int{"A": 2, "B": 1, "C": 2, "D": 1, "E": 2, "F": 3}
+	popAll := func(pq *PriorityQueue) []string {
+		var order []string
+		for pq.Len() > 0 {
+			order = append(order, heap.Pop(pq).(*Node).Value)
+		}
+		return order
+	}
+	want := []string{"B", "D", "A", "C", "E", "F"}
+
+	rnd := rand.New(rand.NewPCG(7, 8))
+	for run := 0; run < 200; run++ {
+		nodes := slices.Clone(*InitializeHeap(frequencyMap))
+		rnd.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+
+		pq := &PriorityQueue{}
+		for _, node := range nodes {
+			heap.Push(pq, node)
+		}
+		if got := popAll(pq); !slices.Equal(got, want) {
+			t.Fatalf("run %d: pop order %v, want %v", run, got, want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package generate_codes
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Length-limited codes.
+// Huffman tree gives the optimal code lengths, but for a skewed command log the longest code
+// can be very long (the depth grows with the Fibonacci-like frequencies).
+// Decoders with a fixed size shift register need a limit on the code length,
+// so the lengths are computed with the package-merge algorithm (Larmore and Hirschberg),
+// which gives the optimal lengths under the constraint that no code is longer than maxLength.
+// The codes are then assigned in canonical order like in canonical.go.
+
+// ErrMaxCodeLengthTooSmall is returned when the distinct commands don't fit in codes of the given length
+var ErrMaxCodeLengthTooSmall = errors.New("max code length too small for the number of distinct commands")
+
+// ErrInvalidMaxCodeLength is returned for a negative max code length or a limit above MaxCodeLengthLimit
+var ErrInvalidMaxCodeLength = errors.New("invalid max code length")
+
+// MaxCodeLengthLimit is the largest limit that can be used - codes longer than this are not
+// expected by any decoder and the number of distinct commands is far below 2^64
+const MaxCodeLengthLimit = 64
+
+// CheckMaxCodeLength checks if numOfCommands distinct commands can get codes not longer than maxLength
+// maxLength = 0 means no limit, larger limits than MaxCodeLengthLimit are rejected
+// (the binary codebook stores the limit in one byte)
+func CheckMaxCodeLength(numOfCommands int, maxLength int) error {
+	if maxLength < 0 || maxLength > MaxCodeLengthLimit {
+		return fmt.Errorf("%w: must be from 0 to %d, got %d", ErrInvalidMaxCodeLength, MaxCodeLengthLimit, maxLength)
+	}
+	if maxLength == 0 {
+		return nil
+	}
+	// compared as bit counts - 1<<maxLength overflows int for the largest limits
+	if bitsNeeded(numOfCommands) > maxLength {
+		return fmt.Errorf("%w: %d commands need codes of at least %d bits", ErrMaxCodeLengthTooSmall, numOfCommands, bitsNeeded(numOfCommands))
+	}
+	return nil
+}
+
+// bitsNeeded returns the smallest length of a fixed-width code for n symbols
+func bitsNeeded(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// packageMergeItem is a leaf (single command) or a package of two items from the previous level
+type packageMergeItem[W Weight] struct {
+	weight  W
+	symbols []int // indexes of the commands inside this item, with repetitions
+}
+
+// GetLengthLimitedCodeLengths computes code lengths not longer than maxLength
+// for the given frequencies and returns them in canonical order
+// maxLength = 0 means no limit (plain Huffman code lengths)
+func GetLengthLimitedCodeLengths(frequencyMap map[string]int, maxLength int) ([]CodeLength, error) {
+	return GetLengthLimitedCodeLengthsFunc(frequencyMap, maxLength, strings.Compare)
+}
+
+// GetLengthLimitedCodeLengthsFunc computes code lengths not longer than maxLength
+// for the frequencies of symbols of any type, compare orders the symbols (see GetCodesFromListOfSymbols)
+func GetLengthLimitedCodeLengthsFunc[S comparable, W Weight](frequencyMap map[S]W, maxLength int, compare func(a, b S) int) ([]SymbolCodeLength[S], error) {
+	if err := CheckMaxCodeLength(len(frequencyMap), maxLength); err != nil {
+		return nil, err
+	}
+	if len(frequencyMap) == 0 {
+		return nil, nil
+	}
+
+	// Huffman lengths are optimal, so when they already fit in the limit there is nothing to do
+	// - this also gives exactly the same codes as without the limit
+	root := BuildHuffmanTree(InitializeHeapFunc(frequencyMap, compare))
+	lengths := GetCodeLengthsFromTree(root)
+	if maxLength == 0 || maxLengthOf(lengths) <= maxLength {
+		return SortCodeLengthsFunc(lengths, compare), nil
+	}
+
+	return SortCodeLengthsFunc(packageMerge(frequencyMap, maxLength, compare), compare), nil
+}
+
+func maxLengthOf[S comparable](lengths map[S]int) int {
+	longest := 0
+	for _, length := range lengths {
+		longest = max(longest, length)
+	}
+	return longest
+}
+
+// packageMerge returns length-limited code lengths
+// expects at least 2 commands and len(frequencyMap) <= 2^maxLength
+func packageMerge[S comparable, W Weight](frequencyMap map[S]W, maxLength int, compare func(a, b S) int) map[S]int {
+	// Sort commands by frequency (then by value to be deterministic)
+	commands := sortedSymbols(frequencyMap, compare)
+	sort.SliceStable(commands, func(i, j int) bool {
+		return frequencyMap[commands[i]] < frequencyMap[commands[j]]
+	})
+
+	leaves := make([]packageMergeItem[W], len(commands))
+	for i, cmd := range commands {
+		leaves[i] = packageMergeItem[W]{weight: frequencyMap[cmd], symbols: []int{i}}
+	}
+
+	// Each level is the merge of the leaves and packages made from pairs of the previous level.
+	// After maxLength levels, the first 2n-2 items say how many times each command
+	// takes part in the solution - and this is its code length.
+	current := leaves
+	for level := 1; level < maxLength; level++ {
+		packages := make([]packageMergeItem[W], 0, len(current)/2)
+		for i := 0; i+1 < len(current); i += 2 {
+			symbols := make([]int, 0, len(current[i].symbols)+len(current[i+1].symbols))
+			symbols = append(symbols, current[i].symbols...)
+			symbols = append(symbols, current[i+1].symbols...)
+			packages = append(packages, packageMergeItem[W]{
+				weight:  current[i].weight + current[i+1].weight,
+				symbols: symbols,
+			})
+		}
+		current = mergeItems(leaves, packages)
+	}
+
+	counts := make([]int, len(commands))
+	for _, item := range current[:2*len(commands)-2] {
+		for _, symbol := range item.symbols {
+			counts[symbol]++
+		}
+	}
+
+	lengths := make(map[S]int, len(commands))
+	for i, cmd := range commands {
+		lengths[cmd] = counts[i]
+	}
+	return lengths
+}
+
+// mergeItems merges two lists sorted by weight, leaves go first when weights are equal
+func mergeItems[W Weight](leaves, packages []packageMergeItem[W]) []packageMergeItem[W] {
+	merged := make([]packageMergeItem[W], 0, len(leaves)+len(packages))
+	i, j := 0, 0
+	for i < len(leaves) && j < len(packages) {
+		if leaves[i].weight <= packages[j].weight {
+			merged = append(merged, leaves[i])
+			i++
+		} else {
+			merged = append(merged, packages[j])
+			j++
+		}
+	}
+	merged = append(merged, leaves[i:]...)
+	merged = append(merged, packages[j:]...)
+	return merged
+}
+
+// GetLengthLimitedCodesFromListOfCommands generates canonical codes not longer than maxLength
+// for a given list of commands
+// maxLength = 0 means no limit
+// returns map/hash table with {key="command", value="code"}
+func GetLengthLimitedCodesFromListOfCommands(commands []string, maxLength int) (map[string]string, error) {
+	return GetLengthLimitedCodesFromListOfSymbols(commands, maxLength, strings.Compare)
+}
+
+// GetLengthLimitedCodesFromListOfSymbols generates canonical codes not longer than maxLength
+// for a given list of symbols of any type
+// returns map/hash table with {key=symbol, value="code"}
+func GetLengthLimitedCodesFromListOfSymbols[S comparable](symbols []S, maxLength int, compare func(a, b S) int) (map[S]string, error) {
+	if len(symbols) == 0 {
+		return nil, nil
+	}
+
+	codeLengths, err := GetLengthLimitedCodeLengthsFunc(countFrequencies(symbols), maxLength, compare)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetCanonicalCodesFromCodeLengthsFunc(codeLengths, compare), nil
+}
@@ -0,0 +1,153 @@
+package generate_codes
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestCheckMaxCodeLength(t *testing.T) {
+	tests := []struct {
+		numOfCommands int
+		maxLength     int
+		wantErr       error
+	}{
+		{numOfCommands: 5, maxLength: 0},
+		{numOfCommands: 0, maxLength: 1},
+		{numOfCommands: 1, maxLength: 1},
+		{numOfCommands: 2, maxLength: 1},
+		{numOfCommands: 3, maxLength: 1, wantErr: ErrMaxCodeLengthTooSmall},
+		{numOfCommands: 4, maxLength: 2},
+		{numOfCommands: 5, maxLength: 2, wantErr: ErrMaxCodeLengthTooSmall},
+		{numOfCommands: 5, maxLength: 3},
+		{numOfCommands: 1 << 40, maxLength: 39, wantErr: ErrMaxCodeLengthTooSmall},
+		{numOfCommands: 1 << 40, maxLength: 40},
+		{numOfCommands: 5, maxLength: 63},
+		{numOfCommands: 5, maxLength: MaxCodeLengthLimit},
+		{numOfCommands: 5, maxLength: MaxCodeLengthLimit + 1, wantErr: ErrInvalidMaxCodeLength},
+		{numOfCommands: 5, maxLength: 1000, wantErr: ErrInvalidMaxCodeLength},
+		{numOfCommands: 5, maxLength: -1, wantErr: ErrInvalidMaxCodeLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d commands, max %d", tt.numOfCommands, tt.maxLength), func(t *testing.T) {
+			err := CheckMaxCodeLength(tt.numOfCommands, tt.maxLength)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("CheckMaxCodeLength(%d, %d) = %v, want %v", tt.numOfCommands, tt.maxLength, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// optimalLengthLimitedCost tries all code lengths from 1 to maxLength which satisfy the Kraft inequality
+// and returns the lowest sum of weight * length
+func optimalLengthLimitedCost(weights []int, maxLength int) int {
+	best := -1
+	// kraft is the sum of 2^-length in units of 2^-maxLength
+	var try func(i, kraft, cost int)
+	try = func(i, kraft, cost int) {
+		if kraft > 1<<maxLength || (best >= 0 && cost >= best) {
+			return
+		}
+		if i == len(weights) {
+			best = cost
+			return
+		}
+		for length := 1; length <= maxLength; length++ {
+			try(i+1, kraft+1<<(maxLength-length), cost+weights[i]*length)
+		}
+	}
+	try(0, 0, 0)
+	return best
+}
+
+func checkLengthLimitedLengths(t *testing.T, frequencyMap map[string]int, lengths map[string]int, maxLength int) int {
+	t.Helper()
+	if len(lengths) != len(frequencyMap) {
+		t.Fatalf("got %d lengths for %d commands: %v", len(lengths), len(frequencyMap), lengths)
+	}
+	kraft, cost := 0, 0
+	for cmd, frequency := range frequencyMap {
+		length := lengths[cmd]
+		if length < 1 || length > maxLength {
+			t.Fatalf("length of %q is %d, want 1..%d: %v", cmd, length, maxLength, lengths)
+		}
+		kraft += 1 << (maxLength - length)
+		cost += frequency * length
+	}
+	if kraft > 1<<maxLength {
+		t.Fatalf("lengths %v don't satisfy the Kraft inequality", lengths)
+	}
+	return cost
+}
+
+func TestPackageMergeIsOptimal(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	for trial := 0; trial < 2000; trial++ {
+		n := 2 + rnd.IntN(5)
+		maxLength := bitsNeeded(n) + rnd.IntN(6-bitsNeeded(n))
+		frequencyMap := make(map[string]int, n)
+		weights := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			// skewed weights, so the Huffman codes are often longer than the limit
+			frequency := rnd.IntN(3) * (1 << rnd.IntN(8))
+			frequencyMap[fmt.Sprintf("cmd%d", i)] = frequency
+			weights = append(weights, frequency)
+		}
+		want := optimalLengthLimitedCost(weights, maxLength)
+
+		got := checkLengthLimitedLengths(t, frequencyMap, packageMerge(frequencyMap, maxLength, strings.Compare), maxLength)
+		if got != want {
+			t.Fatalf("packageMerge(%v, %d) cost = %d, want %d", frequencyMap, maxLength, got, want)
+		}
+
+		codeLengths, err := GetLengthLimitedCodeLengths(frequencyMap, maxLength)
+		if err != nil {
+			t.Fatalf("GetLengthLimitedCodeLengths(%v, %d): %v", frequencyMap, maxLength, err)
+		}
+		lengths := make(map[string]int, len(codeLengths))
+		for _, cl := range codeLengths {
+			lengths[cl.Command] = cl.Length
+		}
+		if got := checkLengthLimitedLengths(t, frequencyMap, lengths, maxLength); got != want {
+			t.Fatalf("GetLengthLimitedCodeLengths(%v, %d) cost = %d, want %d", frequencyMap, maxLength, got, want)
+		}
+	}
+}
+
+func TestGetLengthLimitedCodesFromListOfCommands(t *testing.T) {
+	// Fibonacci frequencies give the deepest Huffman tree - codes up to 7 bits without the limit
+	var commands []string
+	a, b := 1, 1
+	for i := 0; i < 8; i++ {
+		for j := 0; j < a; j++ {
+			commands = append(commands, fmt.Sprintf("cmd%d", i))
+		}
+		a, b = b, a+b
+	}
+
+	for maxLength := 3; maxLength <= 8; maxLength++ {
+		codes, err := GetLengthLimitedCodesFromListOfCommands(commands, maxLength)
+		if err != nil {
+			t.Fatalf("maxLength %d: %v", maxLength, err)
+		}
+		if _, err := BuildTreeFromCodes(codes); err != nil {
+			t.Fatalf("maxLength %d: codes %v are not a prefix code: %v", maxLength, codes, err)
+		}
+		if !IsCanonical(codes) {
+			t.Fatalf("maxLength %d: codes %v are not canonical", maxLength, codes)
+		}
+		for cmd, code := range codes {
+			if len(code) > maxLength {
+				t.Fatalf("maxLength %d: code of %q is %q", maxLength, cmd, code)
+			}
+		}
+	}
+
+	if _, err := GetLengthLimitedCodesFromListOfCommands(commands, 2); !errors.Is(err, ErrMaxCodeLengthTooSmall) {
+		t.Fatalf("8 commands with maxLength 2: got %v, want %v", err, ErrMaxCodeLengthTooSmall)
+	}
+}
@@ -0,0 +1,94 @@
+package generate_codes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Statistics of a codebook used for a command log, to judge how good the codes are.
+//  - entropy H = -sum(p * log2(p)) - the lower bound of the average code length (bits per command),
+//  - average code length L = sum(p * length) - what the codebook really uses,
+//  - redundancy = L - H, efficiency = H / L (1 is optimal).
+// Huffman codes have L < H + 1, length-limited codes can be a bit longer.
+// The encoded size is compared with a fixed-width code (every command gets the same number of bits)
+// and with the commands encoded as a JSON array, how they are sent to the API.
+
+// Stats are the statistics of a codebook for a list of commands
+type Stats struct {
+	Commands          int     `json:"commands"`         // number of commands in the list
+	DistinctCommands  int     `json:"distinctCommands"` // number of codes used
+	Entropy           float64 `json:"entropy"`          // bits per command
+	AverageCodeLength float64 `json:"averageCodeLength"`
+	Redundancy        float64 `json:"redundancy"`
+	Efficiency        float64 `json:"efficiency"`
+	MinCodeLength     int     `json:"minCodeLength"`
+	MaxCodeLength     int     `json:"maxCodeLength"`
+
+	EncodedBits      int `json:"encodedBits"`
+	EncodedBytes     int `json:"encodedBytes"`
+	FixedWidthLength int `json:"fixedWidthLength"` // bits per command of the fixed-width code
+	FixedWidthBits   int `json:"fixedWidthBits"`
+	FixedWidthBytes  int `json:"fixedWidthBytes"`
+	JSONBytes        int `json:"jsonBytes"`
+
+	// original size / encoded size, 2 means the encoded commands take half of the space
+	CompressionRatioFixedWidth float64 `json:"compressionRatioFixedWidth"`
+	CompressionRatioJSON       float64 `json:"compressionRatioJSON"`
+}
+
+// GetStats computes the statistics of the codebook for the commands
+// codebook is a map/hash table with {key="command", value="code"}
+// every command must have a code, the codes of commands not in the list are not counted
+func GetStats(commands []string, codebook map[string]string) (Stats, error) {
+	frequencyMap := make(map[string]int)
+	for _, cmd := range commands {
+		if _, ok := codebook[cmd]; !ok {
+			return Stats{}, fmt.Errorf("%w: %q", ErrUnknownCommand, cmd)
+		}
+		frequencyMap[cmd]++
+	}
+
+	rawJSON, err := json.Marshal(commands)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Commands:         len(commands),
+		DistinctCommands: len(frequencyMap),
+		JSONBytes:        len(rawJSON),
+	}
+	if len(commands) == 0 {
+		return stats, nil
+	}
+
+	stats.MinCodeLength = math.MaxInt
+	total := float64(len(commands))
+	for cmd, frequency := range frequencyMap {
+		length := len(codebook[cmd])
+		p := float64(frequency) / total
+
+		stats.Entropy -= p * math.Log2(p)
+		stats.AverageCodeLength += p * float64(length)
+		stats.EncodedBits += frequency * length
+		stats.MinCodeLength = min(stats.MinCodeLength, length)
+		stats.MaxCodeLength = max(stats.MaxCodeLength, length)
+	}
+	stats.Redundancy = stats.AverageCodeLength - stats.Entropy
+	if stats.AverageCodeLength > 0 {
+		stats.Efficiency = stats.Entropy / stats.AverageCodeLength
+	}
+	stats.EncodedBytes = (stats.EncodedBits + 7) / 8
+
+	// a code needs at least one bit, also for a single distinct command
+	stats.FixedWidthLength = max(bitsNeeded(stats.DistinctCommands), 1)
+	stats.FixedWidthBits = stats.FixedWidthLength * stats.Commands
+	stats.FixedWidthBytes = (stats.FixedWidthBits + 7) / 8
+
+	if stats.EncodedBits > 0 {
+		stats.CompressionRatioFixedWidth = float64(stats.FixedWidthBits) / float64(stats.EncodedBits)
+		stats.CompressionRatioJSON = float64(stats.JSONBytes*8) / float64(stats.EncodedBits)
+	}
+	return stats, nil
+}
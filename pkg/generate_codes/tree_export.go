@@ -0,0 +1,208 @@
+package generate_codes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Export of the Huffman tree, to see which nodes were merged when the codes look wrong.
+// Three formats:
+//  - DOT (Graphviz) - render with e.g. "dot -Tsvg tree.dot > tree.svg",
+//  - JSON - nested objects, one per node,
+//  - text - an ASCII tree like the output of the "tree" command.
+// In all formats the left edge is "0" and the right edge is "1", like in generateHuffmanCodesIterative.
+// The path of edges to a leaf is its code only for tree-walk codes - canonical and length-limited codes
+// are assigned again, so the codes given to the exporters (e.g. the served ones) are shown at the leaves.
+// All traversals are iterative - the same reason as in generateHuffmanCodesIterative.
+
+// SymbolTreeNode is the JSON form of a SymbolNode
+type SymbolTreeNode[S comparable, W Weight] struct {
+	Command   *S                    `json:"command,omitempty"` // only for leaves
+	Frequency W                     `json:"frequency"`
+	Path      string                `json:"path"`           // edges from the root, "" for the root
+	Code      *string               `json:"code,omitempty"` // code of the leaf from the given codes
+	Leaf      bool                  `json:"leaf"`
+	Left      *SymbolTreeNode[S, W] `json:"left,omitempty"`
+	Right     *SymbolTreeNode[S, W] `json:"right,omitempty"`
+}
+
+// TreeNode is the JSON form of a Node
+type TreeNode = SymbolTreeNode[string, int]
+
+func isLeaf[S comparable, W Weight](node *SymbolNode[S, W]) bool {
+	return node.Left == nil && node.Right == nil
+}
+
+// GetTreeFromListOfCommands builds the Huffman tree of the commands, nil for no commands
+func GetTreeFromListOfCommands(commands []string) *Node {
+	return GetTreeFromListOfSymbols(commands, strings.Compare)
+}
+
+// GetTreeFromListOfSymbols builds the Huffman tree of the symbols of any type, nil for no symbols
+func GetTreeFromListOfSymbols[S comparable](symbols []S, compare func(a, b S) int) *SymbolNode[S, int] {
+	if len(symbols) == 0 {
+		return nil
+	}
+
+	return BuildHuffmanTree(InitializeHeapFunc(countFrequencies(symbols), compare))
+}
+
+// TreeToJSON converts the tree to SymbolTreeNodes, ready to be encoded with encoding/json,
+// codes are the codes of the leaves (map/hash table with {key=symbol, value="code"}), nil - no codes
+func TreeToJSON[S comparable, W Weight](root *SymbolNode[S, W], codes map[S]string) *SymbolTreeNode[S, W] {
+	if root == nil {
+		return nil
+	}
+
+	rootJSON := &SymbolTreeNode[S, W]{}
+	stack := []*SymbolNode[S, W]{root}
+	jsonStack := []*SymbolTreeNode[S, W]{rootJSON}
+
+	for len(stack) > 0 {
+		node, nodeJSON := stack[len(stack)-1], jsonStack[len(jsonStack)-1]
+		stack, jsonStack = stack[:len(stack)-1], jsonStack[:len(jsonStack)-1]
+
+		nodeJSON.Frequency = node.Frequency
+		if isLeaf(node) {
+			nodeJSON.Command = &node.Value
+			nodeJSON.Leaf = true
+			if code, ok := codes[node.Value]; ok {
+				nodeJSON.Code = &code
+			}
+			continue
+		}
+
+		if node.Left != nil {
+			nodeJSON.Left = &SymbolTreeNode[S, W]{Path: nodeJSON.Path + "0"}
+			stack, jsonStack = append(stack, node.Left), append(jsonStack, nodeJSON.Left)
+		}
+		if node.Right != nil {
+			nodeJSON.Right = &SymbolTreeNode[S, W]{Path: nodeJSON.Path + "1"}
+			stack, jsonStack = append(stack, node.Right), append(jsonStack, nodeJSON.Right)
+		}
+	}
+
+	return rootJSON
+}
+
+// dotQuote returns s as a quoted DOT string
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// TreeToDOT returns the tree as a Graphviz digraph,
+// internal nodes show the sum of frequencies, leaves the command and its frequency,
+// edges are labeled with the bit and the frequency of the child,
+// leaves also show their code from codes (nil - no codes)
+// symbols and weights are formatted with fmt (%v)
+func TreeToDOT[S comparable, W Weight](root *SymbolNode[S, W], codes map[S]string) string {
+	var sb strings.Builder
+	sb.WriteString("digraph huffman {\n")
+	sb.WriteString("\tnode [shape=circle];\n")
+
+	if root == nil {
+		sb.WriteString("}\n")
+		return sb.String()
+	}
+
+	// nodes are numbered in the order of the traversal (preorder, left first),
+	// the edge from the parent is written when the child is visited
+	type item struct {
+		node     *SymbolNode[S, W]
+		parentID int // -1 for the root
+		bit      string
+	}
+	nextID := 0
+	stack := []item{{node: root, parentID: -1}}
+
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		id := nextID
+		nextID++
+		if isLeaf(it.node) {
+			label := fmt.Sprintf("%v\n%v", it.node.Value, it.node.Frequency)
+			if code, ok := codes[it.node.Value]; ok {
+				label += "\ncode " + code
+			}
+			fmt.Fprintf(&sb, "\tn%d [shape=box, label=%s];\n", id, dotQuote(label))
+		} else {
+			fmt.Fprintf(&sb, "\tn%d [label=%s];\n", id, dotQuote(fmt.Sprint(it.node.Frequency)))
+		}
+		if it.parentID >= 0 {
+			fmt.Fprintf(&sb, "\tn%d -> n%d [label=%s];\n", it.parentID, id, dotQuote(fmt.Sprintf("%s (%v)", it.bit, it.node.Frequency)))
+		}
+
+		// the right child is pushed first, so the left one is visited first
+		if it.node.Right != nil {
+			stack = append(stack, item{node: it.node.Right, parentID: id, bit: "1"})
+		}
+		if it.node.Left != nil {
+			stack = append(stack, item{node: it.node.Left, parentID: id, bit: "0"})
+		}
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// TreeToText returns the tree drawn with ASCII characters, one node per line,
+// leaves also show their code from codes (nil - no codes), e.g. with canonical codes:
+//
+//	(7)
+//	|-- 0: (3)
+//	|   |-- 0: GRAB (1) code=11
+//	|   `-- 1: BACK (2) code=10
+//	`-- 1: LEFT (4) code=0
+func TreeToText[S comparable, W Weight](root *SymbolNode[S, W], codes map[S]string) string {
+	if root == nil {
+		return ""
+	}
+
+	type item struct {
+		node   *SymbolNode[S, W]
+		prefix string // indentation of the node line
+		bit    string // "" for the root
+		last   bool   // the last child of its parent
+	}
+	var sb strings.Builder
+	stack := []item{{node: root}}
+
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		childPrefix := ""
+		if it.bit != "" {
+			connector, indent := "|-- ", "|   "
+			if it.last {
+				connector, indent = "`-- ", "    "
+			}
+			sb.WriteString(it.prefix + connector + it.bit + ": ")
+			childPrefix = it.prefix + indent
+		}
+		if isLeaf(it.node) {
+			fmt.Fprintf(&sb, "%v (%v)", it.node.Value, it.node.Frequency)
+			if code, ok := codes[it.node.Value]; ok {
+				sb.WriteString(" code=" + code)
+			}
+			sb.WriteString("\n")
+		} else {
+			fmt.Fprintf(&sb, "(%v)\n", it.node.Frequency)
+		}
+
+		// the right child is pushed first, so the left one is drawn first
+		if it.node.Right != nil {
+			stack = append(stack, item{node: it.node.Right, prefix: childPrefix, bit: "1", last: true})
+		}
+		if it.node.Left != nil {
+			stack = append(stack, item{node: it.node.Left, prefix: childPrefix, bit: "0", last: it.node.Right == nil})
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+package generate_codes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Codes from weights.
+// The ...ListOfCommands and ...ListOfSymbols functions need the full list and count the frequencies themselves,
+// these functions take the weight of every symbol instead - counts from another system or probabilities
+// estimated offline. Integer and float weights can be used, weights are only compared and added,
+// so counts give the same codes as the list they were counted from (floats as long as the sums are exact).
+// Weights can be given as a map or as a slice of (symbol, weight) pairs converted with WeightsFromSlice.
+
+// ErrInvalidWeight is returned for a negative, NaN or infinite weight
+var ErrInvalidWeight = errors.New("invalid weight")
+
+// ErrDuplicateSymbol is returned when a symbol has more than one weight
+var ErrDuplicateSymbol = errors.New("duplicate symbol")
+
+// WeightedSymbol is a symbol with its weight (count or probability)
+type WeightedSymbol[S comparable, W Weight] struct {
+	Symbol S `json:"symbol"`
+	Weight W `json:"weight"`
+}
+
+// WeightsFromSlice returns the weights of the pairs as a map/hash table with {key=symbol, value=weight}
+// every symbol must be in the list only once
+func WeightsFromSlice[S comparable, W Weight](weightedSymbols []WeightedSymbol[S, W]) (map[S]W, error) {
+	weights := make(map[S]W, len(weightedSymbols))
+	for _, ws := range weightedSymbols {
+		if _, ok := weights[ws.Symbol]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrDuplicateSymbol, ws.Symbol)
+		}
+		weights[ws.Symbol] = ws.Weight
+	}
+	return weights, nil
+}
+
+// checkWeights accepts zero weights - such symbols get the longest codes
+func checkWeights[S comparable, W Weight](weights map[S]W) error {
+	for symbol, weight := range weights {
+		if weight < 0 || math.IsNaN(float64(weight)) || math.IsInf(float64(weight), 0) {
+			return fmt.Errorf("%w: %v for symbol %v", ErrInvalidWeight, weight, symbol)
+		}
+	}
+	return nil
+}
+
+// GetCodesFromWeights generates Huffman codes (from the tree walk) for the weights of the symbols,
+// compare orders the symbols to break ties between equal weights
+// returns map/hash table with {key=symbol, value="code"}
+func GetCodesFromWeights[S comparable, W Weight](weights map[S]W, compare func(a, b S) int) (map[S]string, error) {
+	if err := checkWeights(weights); err != nil {
+		return nil, err
+	}
+	if len(weights) == 0 {
+		return nil, nil
+	}
+
+	root := BuildHuffmanTree(InitializeHeapFunc(weights, compare))
+	return generateHuffmanCodesIterative(root), nil
+}
+
+// GetCanonicalCodesFromWeights generates canonical Huffman codes for the weights of the symbols
+// returns map/hash table with {key=symbol, value="code"}
+func GetCanonicalCodesFromWeights[S comparable, W Weight](weights map[S]W, compare func(a, b S) int) (map[S]string, error) {
+	return GetLengthLimitedCodesFromWeights(weights, 0, compare)
+}
+
+// GetLengthLimitedCodesFromWeights generates canonical codes not longer than maxLength
+// for the weights of the symbols, maxLength = 0 means no limit
+// returns map/hash table with {key=symbol, value="code"}
+func GetLengthLimitedCodesFromWeights[S comparable, W Weight](weights map[S]W, maxLength int, compare func(a, b S) int) (map[S]string, error) {
+	if err := checkWeights(weights); err != nil {
+		return nil, err
+	}
+
+	codeLengths, err := GetLengthLimitedCodeLengthsFunc(weights, maxLength, compare)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetCanonicalCodesFromCodeLengthsFunc(codeLengths, compare), nil
+}
@@ -0,0 +1,138 @@
+package generate_codes
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestGetCodesFromWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		want    map[string]string
+	}{
+		{name: "empty", weights: map[string]float64{}},
+		{name: "single symbol", weights: map[string]float64{"A": 0.3}, want: map[string]string{"A": "0"}},
+		{
+			name:    "probabilities",
+			weights: map[string]float64{"A": 0.5, "B": 0.25, "C": 0.125, "D": 0.125},
+			want:    map[string]string{"A": "0", "B": "10", "C": "110", "D": "111"},
+		},
+		{
+			// zero weights are allowed and get the longest codes
+			name:    "zero weights",
+			weights: map[string]float64{"A": 1, "B": 0, "C": 0},
+			want:    map[string]string{"A": "1", "B": "00", "C": "01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetCodesFromWeights(tt.weights, strings.Compare)
+			if err != nil || !maps.Equal(got, tt.want) {
+				t.Fatalf("GetCodesFromWeights(%v) = %v, %v, want %v", tt.weights, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodesFromWeightsMatchListOfCommands(t *testing.T) {
+	commands := strings.Fields("LEFT LEFT GRAB LEFT BACK BACK LEFT UP RIGHT RIGHT RIGHT DROP LEFT")
+
+	counts := make(map[string]int)
+	probabilities := make(map[string]float64)
+	for _, cmd := range commands {
+		counts[cmd]++
+		// powers of two, so the sums of the probabilities are exact
+		probabilities[cmd] += 1.0 / 16
+	}
+
+	want := GetCodesFromListOfCommands(commands)
+	if got, err := GetCodesFromWeights(counts, strings.Compare); err != nil || !maps.Equal(got, want) {
+		t.Errorf("counts: got %v, %v, want %v", got, err, want)
+	}
+	if got, err := GetCodesFromWeights(probabilities, strings.Compare); err != nil || !maps.Equal(got, want) {
+		t.Errorf("probabilities: got %v, %v, want %v", got, err, want)
+	}
+
+	wantCanonical := GetCanonicalCodesFromListOfCommands(commands)
+	if got, err := GetCanonicalCodesFromWeights(probabilities, strings.Compare); err != nil || !maps.Equal(got, wantCanonical) {
+		t.Errorf("canonical probabilities: got %v, %v, want %v", got, err, wantCanonical)
+	}
+}
+
+func TestGetLengthLimitedCodesFromWeights(t *testing.T) {
+	// Huffman code lengths are 1, 2, 3, 4, 4
+	weights := map[string]float64{"a": 1, "b": 1e-3, "c": 1e-6, "d": 1e-9, "e": 1e-12}
+
+	tests := []struct {
+		maxLength int
+		want      map[string]string
+		wantErr   error
+	}{
+		{maxLength: 0, want: map[string]string{"a": "0", "b": "10", "c": "110", "d": "1110", "e": "1111"}},
+		{maxLength: 4, want: map[string]string{"a": "0", "b": "10", "c": "110", "d": "1110", "e": "1111"}},
+		// the tiny weights are forced up to the limit, the heavy one keeps its 1-bit code
+		{maxLength: 3, want: map[string]string{"a": "0", "b": "100", "c": "101", "d": "110", "e": "111"}},
+		{maxLength: 2, wantErr: ErrMaxCodeLengthTooSmall},
+		{maxLength: MaxCodeLengthLimit + 1, wantErr: ErrInvalidMaxCodeLength},
+	}
+
+	for _, tt := range tests {
+		got, err := GetLengthLimitedCodesFromWeights(weights, tt.maxLength, strings.Compare)
+		if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) || !maps.Equal(got, tt.want) {
+			t.Errorf("maxLength %d: got %v, %v, want %v, %v", tt.maxLength, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCodesFromWeightsRejectInvalidWeights(t *testing.T) {
+	tests := map[string]map[string]float64{
+		"negative":          {"A": 1, "B": -1},
+		"NaN":               {"A": 1, "B": math.NaN()},
+		"positive infinity": {"A": 1, "B": math.Inf(1)},
+		"negative infinity": {"A": 1, "B": math.Inf(-1)},
+	}
+
+	for name, weights := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := GetCodesFromWeights(weights, strings.Compare); !errors.Is(err, ErrInvalidWeight) {
+				t.Errorf("GetCodesFromWeights: got %v, want %v", err, ErrInvalidWeight)
+			}
+			if _, err := GetCanonicalCodesFromWeights(weights, strings.Compare); !errors.Is(err, ErrInvalidWeight) {
+				t.Errorf("GetCanonicalCodesFromWeights: got %v, want %v", err, ErrInvalidWeight)
+			}
+			if _, err := GetLengthLimitedCodesFromWeights(weights, 8, strings.Compare); !errors.Is(err, ErrInvalidWeight) {
+				t.Errorf("GetLengthLimitedCodesFromWeights: got %v, want %v", err, ErrInvalidWeight)
+			}
+		})
+	}
+
+	if _, err := GetCodesFromWeights(map[string]int{"A": 3, "B": -2}, strings.Compare); !errors.Is(err, ErrInvalidWeight) {
+		t.Errorf("negative int weight: got %v, want %v", err, ErrInvalidWeight)
+	}
+}
+
+func TestWeightsFromSlice(t *testing.T) {
+	weights, err := WeightsFromSlice([]WeightedSymbol[string, float64]{
+		{Symbol: "A", Weight: 0.5},
+		{Symbol: "B", Weight: 0.25},
+		{Symbol: "C", Weight: 0},
+	})
+	if want := map[string]float64{"A": 0.5, "B": 0.25, "C": 0}; err != nil || !maps.Equal(weights, want) {
+		t.Fatalf("WeightsFromSlice = %v, %v, want %v", weights, err, want)
+	}
+
+	weights, err = WeightsFromSlice([]WeightedSymbol[string, float64]{})
+	if err != nil || len(weights) != 0 {
+		t.Fatalf("WeightsFromSlice of an empty slice = %v, %v, want no weights", weights, err)
+	}
+
+	_, err = WeightsFromSlice([]WeightedSymbol[string, int]{{Symbol: "A", Weight: 1}, {Symbol: "B", Weight: 2}, {Symbol: "A", Weight: 3}})
+	if !errors.Is(err, ErrDuplicateSymbol) {
+		t.Fatalf("WeightsFromSlice with a duplicate symbol: got %v, want %v", err, ErrDuplicateSymbol)
+	}
+}
@@ -0,0 +1,264 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Versioned schema migrations for Postgres.
+// Migrations are SQL files embedded in the binary, named {version}_{name}.up.sql and {version}_{name}.down.sql,
+// e.g. 0003_add_command_code_max_code_length.up.sql. They are applied in the order of versions,
+// each in its own transaction, and the applied versions are stored in the schema_migrations table.
+// The first migrations use IF NOT EXISTS, so databases created before migrations are upgraded in place.
+
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+// advisory lock id - only one process migrates the database at a time (e.g. two replicas starting together)
+const migrationLockID = 72_616_323
+
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load returns all embedded migrations sorted by version
+func Load() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "sql/")
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql", base)
+		}
+
+		versionStr, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected {version}_{name}", base)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: invalid version %s", base, versionStr)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the version of the newest embedded migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version of the database schema, 0 if no migration is applied
+func (m *Migrator) Version() (int, error) {
+	if err := m.createVersionTable(); err != nil {
+		return 0, err
+	}
+
+	return currentVersion(context.Background(), m.db)
+}
+
+// AppliedVersion returns the version of the database schema like Version,
+// but doesn't create the schema_migrations table - for health checks
+func (m *Migrator) AppliedVersion(ctx context.Context) (int, error) {
+	return currentVersion(ctx, m.db)
+}
+
+// Up applies all migrations newer than the database schema
+func (m *Migrator) Up() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		version, err := currentVersion(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+
+			slog.Info("Applying migration", "version", migration.Version, "name", migration.Name)
+			if err := m.apply(conn, migration.Up, "INSERT INTO schema_migrations (version) VALUES ($1);", migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the last steps migrations
+func (m *Migrator) Down(steps int) error {
+	return m.withLock(func(conn *sql.Conn) error {
+		for ; steps > 0; steps-- {
+			version, err := currentVersion(context.Background(), conn)
+			if err != nil {
+				return err
+			}
+			if version == 0 {
+				return nil
+			}
+
+			migration, ok := m.find(version)
+			if !ok {
+				return fmt.Errorf("%w: %d (database is newer than this binary)", ErrUnknownVersion, version)
+			}
+
+			slog.Info("Reverting migration", "version", migration.Version, "name", migration.Name)
+			if err := m.apply(conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1;", migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// apply runs the migration and updates schema_migrations in one transaction
+func (m *Migrator) apply(conn *sql.Conn, migrationSQL string, versionQuery string, version int) error {
+	ctx := context.Background()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migrationSQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, versionQuery, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withLock runs f on a single connection holding the migration advisory lock
+func (m *Migrator) withLock(f func(conn *sql.Conn) error) error {
+	if err := m.createVersionTable(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", migrationLockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", migrationLockID)
+
+	return f(conn)
+}
+
+func (m *Migrator) createVersionTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+	`
+
+	if _, err := m.db.Exec(query); err != nil {
+		slog.Error("Error creating schema_migrations table", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func currentVersion(ctx context.Context, db queryRower) (int, error) {
+	var version int
+	query := "SELECT COALESCE(MAX(version), 0) FROM schema_migrations;"
+	if err := db.QueryRowContext(ctx, query).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
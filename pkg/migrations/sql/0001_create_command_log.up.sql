@@ -0,0 +1,7 @@
+-- IF NOT EXISTS - deployments created before migrations already have the table
+-- JSONB uses more memory, but may be more future-proof than TEXT[] - in case the input format changes
+CREATE TABLE IF NOT EXISTS CommandLog (
+	id serial PRIMARY KEY,
+	commands JSONB NOT NULL,
+	timestamp TIMESTAMP
+);
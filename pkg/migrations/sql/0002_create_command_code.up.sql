@@ -0,0 +1,7 @@
+-- IF NOT EXISTS - deployments created before migrations already have the table
+CREATE TABLE IF NOT EXISTS CommandCode (
+	id serial PRIMARY KEY,
+	commandLogID INT REFERENCES CommandLog(id) ON DELETE CASCADE,
+	command TEXT,
+	commandCode TEXT
+);
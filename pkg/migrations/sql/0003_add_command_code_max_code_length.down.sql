@@ -0,0 +1 @@
+ALTER TABLE CommandCode DROP COLUMN IF EXISTS maxCodeLength;
@@ -0,0 +1,2 @@
+-- IF NOT EXISTS - the column was added by the app itself before migrations
+ALTER TABLE CommandCode ADD COLUMN IF NOT EXISTS maxCodeLength INT NOT NULL DEFAULT 0;
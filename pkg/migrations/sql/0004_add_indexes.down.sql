@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS commandcode_commandlogid_idx;
+DROP INDEX IF EXISTS commandlog_timestamp_idx;
@@ -0,0 +1,4 @@
+-- latest command log and retention policy
+CREATE INDEX IF NOT EXISTS commandlog_timestamp_idx ON CommandLog (timestamp);
+-- codes of the command log
+CREATE INDEX IF NOT EXISTS commandcode_commandlogid_idx ON CommandCode (commandLogID);
@@ -0,0 +1 @@
+ALTER TABLE CommandCode DROP CONSTRAINT IF EXISTS commandcode_commandlogid_command_key;
@@ -0,0 +1,13 @@
+-- concurrent code generation could store the codes of a log twice, from two independently built codebooks,
+-- and their inserts could interleave - the rows can't be split back into the two codebooks,
+-- and mixing them can give codes that are not prefix-free. All codes of such logs are deleted,
+-- they are generated again on the next request.
+DELETE FROM CommandCode
+	WHERE commandLogID IN (
+		SELECT commandLogID FROM CommandCode
+			GROUP BY commandLogID, command
+			HAVING COUNT(*) > 1
+	);
+
+ALTER TABLE CommandCode
+	ADD CONSTRAINT commandcode_commandlogid_command_key UNIQUE (commandLogID, command);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS commandcode_command_idx;
+DROP INDEX IF EXISTS commandlog_commands_idx;
@@ -0,0 +1,4 @@
+-- "contains command" filter of GET /commands
+CREATE INDEX IF NOT EXISTS commandlog_commands_idx ON CommandLog USING GIN ((commands->'commands'));
+-- command filter of GET /allCommandCodes
+CREATE INDEX IF NOT EXISTS commandcode_command_idx ON CommandCode (command);
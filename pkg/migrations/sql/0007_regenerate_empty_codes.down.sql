@@ -0,0 +1 @@
+-- nothing to undo - the deleted codes are generated again when they are requested
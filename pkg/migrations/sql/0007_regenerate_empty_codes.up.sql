@@ -0,0 +1,7 @@
+-- before single commands got a 1-bit code, the only command of a log got the empty code "",
+-- which can't be encoded or decoded. All codes of such logs are deleted,
+-- they are generated again on the next request.
+DELETE FROM CommandCode
+	WHERE commandLogID IN (
+		SELECT commandLogID FROM CommandCode WHERE commandCode = ''
+	);
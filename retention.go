@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy says which command logs are kept in the storage,
+// a log is deleted if any of the limits is exceeded, 0 means no limit
+type RetentionPolicy struct {
+	MaxLogs int           // keep only the last MaxLogs command logs
+	MaxAge  time.Duration // keep only command logs younger than MaxAge
+}
+
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.MaxLogs == 0 && p.MaxAge == 0
+}
+
+// selectExpiredCommandLogs returns ids of the command logs that are not kept by the policy,
+// for storages that can't do it in a query
+func selectExpiredCommandLogs(commandLogs []*CommandLogRequest, policy RetentionPolicy) map[int]bool {
+	// the newest logs first, like ORDER BY timestamp DESC, id DESC
+	byAge := append([]*CommandLogRequest(nil), commandLogs...)
+	sort.Slice(byAge, func(i, j int) bool {
+		if !byAge[i].Timestamp.Equal(byAge[j].Timestamp) {
+			return byAge[i].Timestamp.After(byAge[j].Timestamp)
+		}
+		return byAge[i].ID > byAge[j].ID
+	})
+
+	cutoff := time.Now().Add(-policy.MaxAge)
+	expiredIDs := make(map[int]bool)
+	for i, commandLog := range byAge {
+		if (policy.MaxLogs > 0 && i >= policy.MaxLogs) || (policy.MaxAge > 0 && commandLog.Timestamp.Before(cutoff)) {
+			expiredIDs[commandLog.ID] = true
+		}
+	}
+	return expiredIDs
+}
+
+// retentionJanitor deletes old command logs in the background
+type retentionJanitor struct {
+	storage  Storage
+	policy   RetentionPolicy
+	interval time.Duration
+	// canceled by Stop, so a long cleanup doesn't block the shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRetentionJanitor(storage Storage, policy RetentionPolicy, interval time.Duration) *retentionJanitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &retentionJanitor{
+		storage:  storage,
+		policy:   policy,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the janitor in a new goroutine, the first cleanup is done right away
+func (j *retentionJanitor) Start() {
+	go j.run()
+}
+
+// Stop stops the janitor, cancels the current cleanup and waits until it returns
+func (j *retentionJanitor) Stop() {
+	j.cancel()
+	<-j.done
+}
+
+func (j *retentionJanitor) run() {
+	defer close(j.done)
+
+	if j.policy.IsEmpty() {
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.cleanup()
+
+		select {
+		case <-ticker.C:
+		case <-j.ctx.Done():
+			return
+		}
+	}
+}
+
+func (j *retentionJanitor) cleanup() {
+	deleted, err := j.storage.DeleteOldCommandLogs(j.ctx, j.policy)
+	if err != nil {
+		slog.Error("Error deleting old command logs", "err", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Deleted old command logs", "deleted", deleted)
+	}
+}
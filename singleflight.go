@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// singleFlight makes sure that only one goroutine runs the function for a key at a time,
+// goroutines that call Do with the same key in the meantime wait and get the same result
+// (or stop waiting when their context is done)
+type singleFlight[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*singleFlightCall[V]
+}
+
+var errSingleFlightPanic = errors.New("function called by singleFlight panicked")
+
+type singleFlightCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func newSingleFlight[K comparable, V any]() *singleFlight[K, V] {
+	return &singleFlight[K, V]{calls: make(map[K]*singleFlightCall[V])}
+}
+
+func (g *singleFlight[K, V]) Do(ctx context.Context, key K, f func() (V, error)) (V, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+
+	call := &singleFlightCall[V]{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// the call is removed even if f panics, so the key is not blocked forever
+	// and the waiting goroutines get an error instead of an empty result
+	call.err = errSingleFlightPanic
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = f()
+	return call.value, call.err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+func TestSingleFlight(t *testing.T) {
+	g := newSingleFlight[int, string]()
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		value, err := g.Do(ctx, 1, func() (string, error) {
+			close(started)
+			<-release
+			return "first", nil
+		})
+		if value != "first" || err != nil {
+			t.Errorf("Do = %q, %v, want %q", value, err, "first")
+		}
+	}()
+	<-started
+
+	// the call for key 1 is running, a waiter with a canceled context stops waiting without calling f
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := g.Do(canceledCtx, 1, func() (string, error) {
+		t.Errorf("f called for a key that is already running")
+		return "", nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Do with a canceled context: got %v, want %v", err, context.Canceled)
+	}
+
+	// other keys don't wait
+	if value, err := g.Do(ctx, 2, func() (string, error) { return "second", nil }); value != "second" || err != nil {
+		t.Fatalf("Do for another key = %q, %v, want %q", value, err, "second")
+	}
+
+	close(release)
+	<-firstDone
+
+	// the key is free again after the call
+	if value, err := g.Do(ctx, 1, func() (string, error) { return "again", nil }); value != "again" || err != nil {
+		t.Fatalf("Do after the first call = %q, %v, want %q", value, err, "again")
+	}
+}
+
+func TestSingleFlightPanic(t *testing.T) {
+	g := newSingleFlight[int, string]()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("the panic of f was not passed on")
+			}
+		}()
+		g.Do(context.Background(), 1, func() (string, error) { panic("generation failed") })
+	}()
+
+	// the key is not blocked by the panicked call
+	if value, err := g.Do(context.Background(), 1, func() (string, error) { return "ok", nil }); value != "ok" || err != nil {
+		t.Fatalf("Do after a panic = %q, %v, want %q", value, err, "ok")
+	}
+}
+
+// countingStorage counts the calls of SetCommandCodes, they are slow,
+// so the other requests come while the codes are being stored
+type countingStorage struct {
+	Storage
+	setCommandCodes atomic.Int32
+}
+
+func (s *countingStorage) SetCommandCodes(ctx context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
+	s.setCommandCodes.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return s.Storage.SetCommandCodes(ctx, codes, commandLogID)
+}
+
+func TestConcurrentRequestsGenerateCodesOnce(t *testing.T) {
+	storage := &countingStorage{Storage: NewMemoryStorage()}
+	handler := NewApiServer(":0", ServerConfig{}, storage, generate_codes.AlgorithmHuffman, 0).router()
+	postCommandLog(t, handler, "LEFT", "LEFT", "GRAB", "LEFT", "BACK", "BACK", "UP", "RIGHT", "RIGHT", "DROP")
+
+	const requests = 50
+	results := make([]map[string]string, requests)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := doRequest(t, handler, "GET", "/commands/1/codes", "")
+			if recorder.Code != http.StatusOK {
+				t.Errorf("GET /commands/1/codes: status %d, body %s", recorder.Code, recorder.Body)
+				return
+			}
+			var codes []CommandCodeRequest
+			if err := json.Unmarshal(recorder.Body.Bytes(), &codes); err != nil {
+				t.Errorf("decoding %s: %v", recorder.Body, err)
+				return
+			}
+			results[i] = ConvertCommandCodesToMap(codes)
+		}()
+	}
+	wg.Wait()
+
+	// requests that came after the generation find the stored codes
+	if calls := storage.setCommandCodes.Load(); calls != 1 {
+		t.Fatalf("SetCommandCodes called %d times, want once", calls)
+	}
+	for i, codes := range results {
+		if len(codes) != 6 || !maps.Equal(codes, results[0]) {
+			t.Fatalf("request %d got codes %v, request 0 got %v", i, codes, results[0])
+		}
+	}
+}
@@ -1,113 +1,112 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
-)
 
-// temporary solution - no db behavior specified
-// and this is for testing/demonstration purposes only
-const MaxNumOfLogsInDB = 100
+	"command-encoding-service/pkg/config"
+	"command-encoding-service/pkg/migrations"
+)
 
 type Storage interface {
-	SetCommandLog(*CommandLog) (*CommandLogRequest, error)
-	GetAllCommandLogs() ([]*CommandLogRequest, error)
-	GetAllCommandCodes() ([]CommandCodeRequest, error)
-	GetLatestCommandLog() (*CommandLogRequest, error)
-	GetCommandCodesForCommandLog(commandLogID int) ([]CommandCodeRequest, error)
-	SetCommandCodes(codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error)
+	SetCommandLog(ctx context.Context, commandLog *CommandLog) (*CommandLogRequest, error)
+	// ListCommandLogs returns at most filter.Limit command logs sorted by id in filter.Order
+	ListCommandLogs(ctx context.Context, filter CommandLogFilter) ([]*CommandLogRequest, error)
+	// ListCommandCodes returns at most filter.Limit command codes sorted by id in filter.Order
+	ListCommandCodes(ctx context.Context, filter CommandCodeFilter) ([]CommandCodeRequest, error)
+	CountCommandLogs(ctx context.Context) (int, error)
+	GetLatestCommandLog(ctx context.Context) (*CommandLogRequest, error)
+	GetCommandLog(ctx context.Context, id int) (*CommandLogRequest, error)
+	GetCommandCodesForCommandLog(ctx context.Context, commandLogID int) ([]CommandCodeRequest, error)
+	// SetCommandCodes stores codes that don't exist yet for the command log (unique command per log)
+	// and returns all codes of the log
+	SetCommandCodes(ctx context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error)
+	DeleteOldCommandLogs(ctx context.Context, policy RetentionPolicy) (int, error)
+	// Ping checks that the storage is reachable
+	Ping(ctx context.Context) error
+	// SchemaVersion returns the applied and the newest schema version, 0, 0 for storages without migrations
+	SchemaVersion(ctx context.Context) (int, int, error)
+	// Close releases the storage, it is called once, after the server has stopped
+	Close() error
 }
 
+// 4 parameters per row, Postgres allows up to 65535 parameters in a query
+const maxCodesPerInsert = 1000
+
 type SimplePostgresDB struct {
 	db *sql.DB
 }
 
-func NewSimplePostgressDB() (*SimplePostgresDB, error) {
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	sslmode := os.Getenv("PGSSLMODE")
-	port := os.Getenv("DB_PORT")
-	host := os.Getenv("DB_HOST")
-
-	connStr := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s host=%s port=%s", user, password, dbname, sslmode, host, port)
-
-	db, err := sql.Open("postgres", connStr)
+func NewSimplePostgressDB(cfg config.PostgresConfig) (*SimplePostgresDB, error) {
+	db, err := sql.Open("postgres", cfg.ConnString())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	// 0 would mean no idle connections, not the default (2)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
 	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return &SimplePostgresDB{db: db}, nil
 }
 
+// Init brings the schema to the newest version
 func (db *SimplePostgresDB) Init() error {
-	if err := db.createCommandLogTable(); err != nil {
-		return err
-	}
-
-	if err := db.createCommandCodeTable(); err != nil {
+	migrator, err := db.Migrator()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return migrator.Up()
 }
 
-// temporary solution - no db behavior specified
-// and this is for testing/demonstration purposes only
-func (db *SimplePostgresDB) DropCommandLogEntriesIfTooMany() error {
-	query := "SELECT COUNT(*) FROM CommandLog;"
-	var numRows int
-
-	if err := db.db.QueryRow(query).Scan(&numRows); err != nil {
-		return err
-	}
-
-	if numRows <= MaxNumOfLogsInDB {
-		return nil
-	}
-
-	if _, err := db.db.Exec("DROP TABLE IF EXISTS CommandLog CASCADE;"); err != nil {
-		log.Println("Error dropping CommandLog table:", err)
-		return err
-	}
+func (db *SimplePostgresDB) Migrator() (*migrations.Migrator, error) {
+	return migrations.NewMigrator(db.db)
+}
 
-	// Recreate the CommandLog table
-	if err := db.createCommandLogTable(); err != nil {
-		return err
-	}
+func (db *SimplePostgresDB) Ping(ctx context.Context) error {
+	return db.db.PingContext(ctx)
+}
 
-	if _, err := db.db.Exec("DROP TABLE IF EXISTS CommandCode CASCADE;"); err != nil {
-		log.Println("Error dropping CommandLog table:", err)
-		return err
+func (db *SimplePostgresDB) SchemaVersion(ctx context.Context) (int, int, error) {
+	migrator, err := db.Migrator()
+	if err != nil {
+		return 0, 0, err
 	}
 
-	// Recreate the CommandCode table
-	if err := db.createCommandCodeTable(); err != nil {
-		return err
+	version, err := migrator.AppliedVersion(ctx)
+	if err != nil {
+		return 0, 0, err
 	}
-
-	return nil
+	return version, migrator.Latest(), nil
 }
 
-func (db *SimplePostgresDB) SetCommandLog(commandsLog *CommandLog) (*CommandLogRequest, error) {
-
-	// temp solution for demo purposes
-	if err := db.DropCommandLogEntriesIfTooMany(); err != nil {
-		return nil, err
-	}
+func (db *SimplePostgresDB) Close() error {
+	return db.db.Close()
+}
 
-	timestamp := time.Now()
+func (db *SimplePostgresDB) SetCommandLog(ctx context.Context, commandsLog *CommandLog) (*CommandLogRequest, error) {
+	// the column is TIMESTAMP (without time zone) - Postgres drops the offset, so all times are stored
+	// and compared in UTC, like the instants in the other backends
+	timestamp := time.Now().UTC()
 
 	// Marshal the CommandsLogWithTimestamp struct to JSON
 	commandsJSON, err := json.Marshal(commandsLog)
@@ -117,12 +116,13 @@ func (db *SimplePostgresDB) SetCommandLog(commandsLog *CommandLog) (*CommandLogR
 
 	// Execute the SQL query to insert data into the database
 	query := "INSERT INTO CommandLog (commands, timestamp) VALUES ($1::JSONB, $2) RETURNING id;"
-	row := db.db.QueryRow(query, commandsJSON, timestamp)
+	row := db.db.QueryRowContext(ctx, query, commandsJSON, timestamp)
 
 	commandsLogWithTimestamp := &CommandLogRequest{
-		ID:        -1,
-		Commands:  commandsLog.Commands,
-		Timestamp: timestamp,
+		ID:            -1,
+		Commands:      commandsLog.Commands,
+		Timestamp:     timestamp,
+		MaxCodeLength: commandsLog.MaxCodeLength,
 	}
 	// Retrieve the ID from the inserted row
 	if err := row.Scan(&commandsLogWithTimestamp.ID); err != nil {
@@ -133,17 +133,63 @@ func (db *SimplePostgresDB) SetCommandLog(commandsLog *CommandLog) (*CommandLogR
 	return commandsLogWithTimestamp, nil
 }
 
-func (db *SimplePostgresDB) GetAllCommandLogs() ([]*CommandLogRequest, error) {
-	query := "SELECT * FROM CommandLog;"
+// queryConditions builds the WHERE clause of a query, the placeholders are numbered in the order of the conditions
+type queryConditions struct {
+	conditions []string
+	args       []any
+}
+
+// add adds the condition, %d in the condition is replaced by the number of the placeholder of arg
+func (c *queryConditions) add(condition string, arg any) {
+	c.args = append(c.args, arg)
+	c.conditions = append(c.conditions, fmt.Sprintf(condition, len(c.args)))
+}
+
+func (c *queryConditions) where() string {
+	if len(c.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.conditions, " AND ")
+}
+
+// addPage adds the cursor condition and returns ORDER BY and LIMIT of the page
+func (c *queryConditions) addPage(idColumn string, after int, order SortOrder, limit int) string {
+	direction, cursorCondition := "ASC", idColumn+" > $%d"
+	if order == OrderDesc {
+		direction, cursorCondition = "DESC", idColumn+" < $%d"
+	}
+	if after > 0 {
+		c.add(cursorCondition, after)
+	}
+
+	c.args = append(c.args, limit)
+	return fmt.Sprintf(" ORDER BY %s %s LIMIT $%d", idColumn, direction, len(c.args))
+}
 
-	rows, err := db.db.Query(query)
+func (db *SimplePostgresDB) ListCommandLogs(ctx context.Context, filter CommandLogFilter) ([]*CommandLogRequest, error) {
+	var conditions queryConditions
+	if !filter.From.IsZero() {
+		conditions.add("timestamp >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions.add("timestamp < $%d", filter.To)
+	}
+	if filter.Command != "" {
+		// uses the GIN index on the commands array
+		conditions.add("commands->'commands' ? $%d", filter.Command)
+	}
+	page := conditions.addPage("id", filter.After, filter.Order, filter.Limit)
+
+	query := "SELECT id, commands, timestamp FROM CommandLog" + conditions.where() + page + ";"
+
+	rows, err := db.db.QueryContext(ctx, query, conditions.args...)
 	if err != nil {
-		log.Println("Error querying CommandLog table:", err)
+		slog.ErrorContext(ctx, "Error querying CommandLog table", "err", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var commandLogsWithTimestamp []*CommandLogRequest
+	commandLogsWithTimestamp := []*CommandLogRequest{}
 
 	for rows.Next() {
 		var id int
@@ -151,7 +197,7 @@ func (db *SimplePostgresDB) GetAllCommandLogs() ([]*CommandLogRequest, error) {
 		var timestamp time.Time
 
 		if err := rows.Scan(&id, &commandsJSON, &timestamp); err != nil {
-			log.Println("Error scanning row in CommandLog table:", err)
+			slog.ErrorContext(ctx, "Error scanning row in CommandLog table", "err", err)
 			return nil, err
 		}
 
@@ -159,14 +205,15 @@ func (db *SimplePostgresDB) GetAllCommandLogs() ([]*CommandLogRequest, error) {
 
 		// Unmarshal the JSONB field into CommandsLog
 		if err := json.Unmarshal(commandsJSON, &commandLog); err != nil {
-			log.Println("Error unmarshaling JSON in CommandLog table:", err)
+			slog.ErrorContext(ctx, "Error unmarshaling JSON in CommandLog table", "err", err)
 			return nil, err
 		}
 
 		commandLogWithTimestamp := CommandLogRequest{
-			ID:        id,
-			Commands:  commandLog.Commands,
-			Timestamp: timestamp,
+			ID:            id,
+			Commands:      commandLog.Commands,
+			Timestamp:     timestamp,
+			MaxCodeLength: commandLog.MaxCodeLength,
 		}
 
 		commandLogsWithTimestamp =
@@ -174,28 +221,48 @@ func (db *SimplePostgresDB) GetAllCommandLogs() ([]*CommandLogRequest, error) {
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Println("Error iterating over rows in CommandLog table:", err)
+		slog.ErrorContext(ctx, "Error iterating over rows in CommandLog table", "err", err)
 		return nil, err
 	}
 
 	return commandLogsWithTimestamp, nil
 }
 
-func (db *SimplePostgresDB) GetAllCommandCodes() ([]CommandCodeRequest, error) {
-	query := "SELECT id, commandLogID, command, commandCode FROM CommandCode;"
-	rows, err := db.db.Query(query)
+func (db *SimplePostgresDB) ListCommandCodes(ctx context.Context, filter CommandCodeFilter) ([]CommandCodeRequest, error) {
+	from := "CommandCode cc"
+	var conditions queryConditions
+	if filter.CommandLogID != 0 {
+		conditions.add("cc.commandLogID = $%d", filter.CommandLogID)
+	}
+	if filter.Command != "" {
+		conditions.add("cc.command = $%d", filter.Command)
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		// the time filter is on the timestamp of the command log
+		from += " JOIN CommandLog cl ON cl.id = cc.commandLogID"
+		if !filter.From.IsZero() {
+			conditions.add("cl.timestamp >= $%d", filter.From)
+		}
+		if !filter.To.IsZero() {
+			conditions.add("cl.timestamp < $%d", filter.To)
+		}
+	}
+	page := conditions.addPage("cc.id", filter.After, filter.Order, filter.Limit)
+
+	query := "SELECT cc.id, cc.commandLogID, cc.command, cc.commandCode, cc.maxCodeLength FROM " + from + conditions.where() + page + ";"
+	rows, err := db.db.QueryContext(ctx, query, conditions.args...)
 	if err != nil {
-		log.Println("Error querying CommandCode table:", err)
+		slog.ErrorContext(ctx, "Error querying CommandCode table", "err", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var commandCodes []CommandCodeRequest
+	commandCodes := []CommandCodeRequest{}
 
 	for rows.Next() {
 		var cc CommandCodeRequest
-		if err := rows.Scan(&cc.ID, &cc.CommandLogID, &cc.Command, &cc.CommandCode); err != nil {
-			log.Println("Error scanning row from CommandCode table:", err)
+		if err := rows.Scan(&cc.ID, &cc.CommandLogID, &cc.Command, &cc.CommandCode, &cc.MaxCodeLength); err != nil {
+			slog.ErrorContext(ctx, "Error scanning row from CommandCode table", "err", err)
 			return nil, err
 		}
 
@@ -204,17 +271,26 @@ func (db *SimplePostgresDB) GetAllCommandCodes() ([]CommandCodeRequest, error) {
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Println("Error iterating over rows from CommandCode table:", err)
+		slog.ErrorContext(ctx, "Error iterating over rows from CommandCode table", "err", err)
 		return nil, err
 	}
 
 	return commandCodes, nil
 }
 
-func (db *SimplePostgresDB) GetLatestCommandLog() (*CommandLogRequest, error) {
+func (db *SimplePostgresDB) CountCommandLogs(ctx context.Context) (int, error) {
+	var count int
+	if err := db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM CommandLog;").Scan(&count); err != nil {
+		slog.ErrorContext(ctx, "Error counting rows in CommandLog table", "err", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (db *SimplePostgresDB) GetLatestCommandLog(ctx context.Context) (*CommandLogRequest, error) {
 	// Get the latest CommandLog id
 	latestCommandLogQuery := "SELECT id, commands, timestamp FROM CommandLog ORDER BY timestamp DESC LIMIT 1;"
-	commandLogRow := db.db.QueryRow(latestCommandLogQuery)
+	commandLogRow := db.db.QueryRowContext(ctx, latestCommandLogQuery)
 
 	var latestCommandLog CommandLogRequest
 	var commandsJSON []byte
@@ -222,11 +298,11 @@ func (db *SimplePostgresDB) GetLatestCommandLog() (*CommandLogRequest, error) {
 	if err := commandLogRow.Scan(&latestCommandLog.ID, &commandsJSON, &latestCommandLog.Timestamp); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// Handle case where no rows were found
-			log.Println("No matching CommandLog found")
+			slog.DebugContext(ctx, "No matching CommandLog found")
 			return nil, err
 		}
 
-		log.Println("Error scanning row from CommandLog table:", err)
+		slog.ErrorContext(ctx, "Error scanning row from CommandLog table", "err", err)
 		return nil, err
 	}
 
@@ -234,20 +310,47 @@ func (db *SimplePostgresDB) GetLatestCommandLog() (*CommandLogRequest, error) {
 	var commandLog CommandLog
 	// Unmarshal the JSONB field into CommandsLog
 	if err := json.Unmarshal(commandsJSON, &commandLog); err != nil {
-		log.Println("Error unmarshaling JSON in CommandLog table:", err)
+		slog.ErrorContext(ctx, "Error unmarshaling JSON in CommandLog table", "err", err)
 		return nil, err
 	}
 	latestCommandLog.Commands = commandLog.Commands
+	latestCommandLog.MaxCodeLength = commandLog.MaxCodeLength
 
 	return &latestCommandLog, nil
 }
 
-func (db *SimplePostgresDB) GetCommandCodesForCommandLog(commandLogID int) ([]CommandCodeRequest, error) {
+func (db *SimplePostgresDB) GetCommandLog(ctx context.Context, id int) (*CommandLogRequest, error) {
+	query := "SELECT id, commands, timestamp FROM CommandLog WHERE id = $1;"
+	row := db.db.QueryRowContext(ctx, query, id)
+
+	var commandLogRequest CommandLogRequest
+	var commandsJSON []byte
+
+	if err := row.Scan(&commandLogRequest.ID, &commandsJSON, &commandLogRequest.Timestamp); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "Error scanning row from CommandLog table", "err", err)
+		}
+		return nil, err
+	}
+
+	var commandLog CommandLog
+	// Unmarshal the JSONB field into CommandsLog
+	if err := json.Unmarshal(commandsJSON, &commandLog); err != nil {
+		slog.ErrorContext(ctx, "Error unmarshaling JSON in CommandLog table", "err", err)
+		return nil, err
+	}
+	commandLogRequest.Commands = commandLog.Commands
+	commandLogRequest.MaxCodeLength = commandLog.MaxCodeLength
+
+	return &commandLogRequest, nil
+}
+
+func (db *SimplePostgresDB) GetCommandCodesForCommandLog(ctx context.Context, commandLogID int) ([]CommandCodeRequest, error) {
 	// Now, get CommandCode rows for the latest CommandLog
-	commandCodeQuery := "SELECT id, commandLogID, command, commandCode FROM CommandCode WHERE commandLogID = $1;"
-	rows, err := db.db.Query(commandCodeQuery, commandLogID)
+	commandCodeQuery := "SELECT id, commandLogID, command, commandCode, maxCodeLength FROM CommandCode WHERE commandLogID = $1;"
+	rows, err := db.db.QueryContext(ctx, commandCodeQuery, commandLogID)
 	if err != nil {
-		log.Println("Error querying CommandCode table:", err)
+		slog.ErrorContext(ctx, "Error querying CommandCode table", "err", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -256,15 +359,15 @@ func (db *SimplePostgresDB) GetCommandCodesForCommandLog(commandLogID int) ([]Co
 
 	for rows.Next() {
 		var cc CommandCodeRequest
-		if err := rows.Scan(&cc.ID, &cc.CommandLogID, &cc.Command, &cc.CommandCode); err != nil {
-			log.Println("Error scanning row from CommandCode table:", err)
+		if err := rows.Scan(&cc.ID, &cc.CommandLogID, &cc.Command, &cc.CommandCode, &cc.MaxCodeLength); err != nil {
+			slog.ErrorContext(ctx, "Error scanning row from CommandCode table", "err", err)
 			return nil, err
 		}
 		commandCodes = append(commandCodes, cc)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Println("Error iterating over rows from CommandCode table:", err)
+		slog.ErrorContext(ctx, "Error iterating over rows from CommandCode table", "err", err)
 		return nil, err
 	}
 
@@ -272,65 +375,108 @@ func (db *SimplePostgresDB) GetCommandCodesForCommandLog(commandLogID int) ([]Co
 	return commandCodes, nil
 }
 
-func (db *SimplePostgresDB) SetCommandCodes(codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
-	// Create a slice to store the inserted command codes
-	var insertedCodes []CommandCodeRequest
-	log.Println(codes)
-	// Iterate through the provided codes and insert each one into the CommandCode table
-	for _, code := range codes {
-		// Execute the SQL query to insert data into the CommandCode table
-		query := "INSERT INTO CommandCode (commandLogID, command, commandCode) VALUES ($1, $2, $3) RETURNING id, commandLogID, command, commandCode;"
-		row := db.db.QueryRow(query, commandLogID, code.Command, code.Code)
-
-		// Create a CommandCode instance to store the inserted code details
-		var insertedCode CommandCodeRequest
-		// Retrieve the ID from the inserted row
-		if err := row.Scan(&insertedCode.ID, &insertedCode.CommandLogID, &insertedCode.Command, &insertedCode.CommandCode); err != nil {
-			return nil, err
+// SetCommandCodes stores the codes of the command log in one transaction and returns all codes of the log.
+// Codes that already exist for the log (e.g. stored by another replica) are kept,
+// so the result is always the codebook that was stored first.
+func (db *SimplePostgresDB) SetCommandCodes(ctx context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// no-op after Commit
+	defer tx.Rollback()
+
+	// Rows are inserted in the order of the commands - two replicas storing the codes of the same log
+	// lock the unique index entries in the same order, so one waits for the other instead of a deadlock
+	codes = slices.Clone(codes)
+	slices.SortFunc(codes, func(a, b CommandCode) int { return strings.Compare(a.Command, b.Command) })
+
+	// Multi-row insert, in batches - Postgres allows up to 65535 parameters in a query
+	for start := 0; start < len(codes); start += maxCodesPerInsert {
+		batch := codes[start:min(start+maxCodesPerInsert, len(codes))]
+
+		var query strings.Builder
+		query.WriteString("INSERT INTO CommandCode (commandLogID, command, commandCode, maxCodeLength) VALUES ")
+		args := make([]any, 0, 4*len(batch))
+		for i, code := range batch {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", 4*i+1, 4*i+2, 4*i+3, 4*i+4)
+			args = append(args, commandLogID, code.Command, code.Code, code.MaxCodeLength)
 		}
+		query.WriteString(" ON CONFLICT (commandLogID, command) DO NOTHING;")
 
-		// Append the inserted code to the slice
-		insertedCodes = append(insertedCodes, insertedCode)
+		if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+			slog.ErrorContext(ctx, "Error inserting into CommandCode table", "err", err)
+			return nil, err
+		}
 	}
 
-	// Return the slice of inserted command codes
-	return insertedCodes, nil
-}
+	// Read all codes of the log in the same transaction
+	commandCodeQuery := "SELECT id, commandLogID, command, commandCode, maxCodeLength FROM CommandCode WHERE commandLogID = $1 ORDER BY id;"
+	rows, err := tx.QueryContext(ctx, commandCodeQuery, commandLogID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error querying CommandCode table", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
 
-//Create tables
+	var commandCodes []CommandCodeRequest
+	for rows.Next() {
+		var cc CommandCodeRequest
+		if err := rows.Scan(&cc.ID, &cc.CommandLogID, &cc.Command, &cc.CommandCode, &cc.MaxCodeLength); err != nil {
+			slog.ErrorContext(ctx, "Error scanning row from CommandCode table", "err", err)
+			return nil, err
+		}
+		commandCodes = append(commandCodes, cc)
+	}
 
-func (db *SimplePostgresDB) createCommandLogTable() error {
-	//JSONB uses more memory, but may be more future-proof than TEXT[] - in case the input format changes
-	query := `
-		CREATE TABLE IF NOT EXISTS CommandLog (
-			id serial PRIMARY KEY,
-			commands JSONB NOT NULL,
-			timestamp TIMESTAMP
-		);
-	`
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "Error iterating over rows from CommandCode table", "err", err)
+		return nil, err
+	}
 
-	if _, err := db.db.Exec(query); err != nil {
-		log.Println("Error creating CommandLog table:", err)
-		return err
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return commandCodes, nil
 }
 
-func (db *SimplePostgresDB) createCommandCodeTable() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS CommandCode (
-			id serial PRIMARY KEY,
-			commandLogID INT REFERENCES CommandLog(id) ON DELETE CASCADE,
-			command TEXT,
-			commandCode TEXT
-		);
-	`
-
-	if _, err := db.db.Exec(query); err != nil {
-		log.Println("Error creating CommandCode table:", err)
-		return err
+// DeleteOldCommandLogs deletes the oldest command logs that are not kept by the policy,
+// their codes are deleted by ON DELETE CASCADE
+// returns the number of deleted command logs
+func (db *SimplePostgresDB) DeleteOldCommandLogs(ctx context.Context, policy RetentionPolicy) (int, error) {
+	deleted := 0
+
+	if policy.MaxLogs > 0 {
+		query := "DELETE FROM CommandLog WHERE id IN (SELECT id FROM CommandLog ORDER BY timestamp DESC, id DESC OFFSET $1);"
+		result, err := db.db.ExecContext(ctx, query, policy.MaxLogs)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error deleting old rows from CommandLog table", "err", err)
+			return deleted, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(rowsAffected)
+	}
+
+	if policy.MaxAge > 0 {
+		query := "DELETE FROM CommandLog WHERE timestamp < $1;"
+		result, err := db.db.ExecContext(ctx, query, time.Now().UTC().Add(-policy.MaxAge))
+		if err != nil {
+			slog.ErrorContext(ctx, "Error deleting expired rows from CommandLog table", "err", err)
+			return deleted, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(rowsAffected)
 	}
 
-	return nil
+	return deleted, nil
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+// testStorage checks the behavior every Storage must have, newStorage returns an empty storage
+func testStorage(t *testing.T, newStorage func(t *testing.T) Storage) {
+	ctx := context.Background()
+
+	t.Run("command logs", func(t *testing.T) {
+		storage := newStorage(t)
+
+		if _, err := storage.GetLatestCommandLog(ctx); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetLatestCommandLog of an empty storage: got %v, want %v", err, sql.ErrNoRows)
+		}
+
+		for i, commands := range [][]string{{"UP", "DOWN"}, {"LEFT"}, {"GRAB", "GRAB", "BACK"}} {
+			commandLog, err := storage.SetCommandLog(ctx, &CommandLog{Commands: commands, MaxCodeLength: i})
+			if err != nil {
+				t.Fatalf("SetCommandLog: %v", err)
+			}
+			if commandLog.ID != i+1 || commandLog.Timestamp.IsZero() || commandLog.MaxCodeLength != i {
+				t.Fatalf("SetCommandLog(%v) = %+v, want id %d, a timestamp and max code length %d", commands, commandLog, i+1, i)
+			}
+		}
+
+		commandLog, err := storage.GetCommandLog(ctx, 2)
+		if err != nil || commandLog.ID != 2 || !slices.Equal(commandLog.Commands, []string{"LEFT"}) {
+			t.Fatalf("GetCommandLog(2) = %+v, %v", commandLog, err)
+		}
+		// the returned log is a copy
+		commandLog.Commands[0] = "RIGHT"
+		if commandLog, _ := storage.GetCommandLog(ctx, 2); commandLog.Commands[0] != "LEFT" {
+			t.Fatalf("changing the returned log changed the stored one: %v", commandLog.Commands)
+		}
+
+		if _, err := storage.GetCommandLog(ctx, 4); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetCommandLog(4): got %v, want %v", err, sql.ErrNoRows)
+		}
+		if latest, err := storage.GetLatestCommandLog(ctx); err != nil || latest.ID != 3 {
+			t.Fatalf("GetLatestCommandLog = %+v, %v, want id 3", latest, err)
+		}
+		if count, err := storage.CountCommandLogs(ctx); err != nil || count != 3 {
+			t.Fatalf("CountCommandLogs = %d, %v, want 3", count, err)
+		}
+	})
+
+	t.Run("codes stored first are kept", func(t *testing.T) {
+		storage := newStorage(t)
+		commandLog, err := storage.SetCommandLog(ctx, &CommandLog{Commands: []string{"UP", "UP", "DOWN"}})
+		if err != nil {
+			t.Fatalf("SetCommandLog: %v", err)
+		}
+
+		first := []CommandCode{{Command: "UP", Code: "0"}, {Command: "DOWN", Code: "1"}}
+		codes, err := storage.SetCommandCodes(ctx, first, commandLog.ID)
+		if err != nil || len(codes) != 2 {
+			t.Fatalf("SetCommandCodes = %+v, %v, want 2 codes", codes, err)
+		}
+
+		// another replica generated other codes at the same time
+		codes, err = storage.SetCommandCodes(ctx, []CommandCode{{Command: "UP", Code: "1"}, {Command: "DOWN", Code: "0"}}, commandLog.ID)
+		if err != nil {
+			t.Fatalf("SetCommandCodes again: %v", err)
+		}
+		want := map[string]string{"UP": "0", "DOWN": "1"}
+		if got := ConvertCommandCodesToMap(codes); len(codes) != 2 || got["UP"] != want["UP"] || got["DOWN"] != want["DOWN"] {
+			t.Fatalf("SetCommandCodes again = %+v, want the first codes %v", codes, want)
+		}
+
+		stored, err := storage.GetCommandCodesForCommandLog(ctx, commandLog.ID)
+		if err != nil || !slices.Equal(stored, codes) {
+			t.Fatalf("GetCommandCodesForCommandLog = %+v, %v, want %+v", stored, err, codes)
+		}
+		if stored, err := storage.GetCommandCodesForCommandLog(ctx, commandLog.ID+1); err != nil || len(stored) != 0 {
+			t.Fatalf("GetCommandCodesForCommandLog of a missing log = %+v, %v, want no codes", stored, err)
+		}
+
+		if _, err := storage.SetCommandCodes(ctx, first, commandLog.ID+1); err == nil {
+			t.Fatalf("SetCommandCodes for a missing command log: got no error")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		storage := newStorage(t)
+		for _, commands := range [][]string{{"UP"}, {"UP", "DOWN"}, {"DOWN"}, {"UP", "LEFT"}} {
+			commandLog, err := storage.SetCommandLog(ctx, &CommandLog{Commands: commands})
+			if err != nil {
+				t.Fatalf("SetCommandLog: %v", err)
+			}
+			codes := ConvertCodesToCommandCodeSlice(generate_codes.GetCodesFromListOfCommands(commands), 0)
+			if _, err := storage.SetCommandCodes(ctx, codes, commandLog.ID); err != nil {
+				t.Fatalf("SetCommandCodes: %v", err)
+			}
+		}
+
+		logTests := []struct {
+			filter  CommandLogFilter
+			wantIDs []int
+		}{
+			{filter: CommandLogFilter{Limit: 10}, wantIDs: []int{1, 2, 3, 4}},
+			{filter: CommandLogFilter{Limit: 2}, wantIDs: []int{1, 2}},
+			{filter: CommandLogFilter{Limit: 2, After: 2}, wantIDs: []int{3, 4}},
+			{filter: CommandLogFilter{Limit: 10, Order: OrderDesc}, wantIDs: []int{4, 3, 2, 1}},
+			{filter: CommandLogFilter{Limit: 2, After: 3, Order: OrderDesc}, wantIDs: []int{2, 1}},
+			{filter: CommandLogFilter{Limit: 10, Command: "DOWN"}, wantIDs: []int{2, 3}},
+			{filter: CommandLogFilter{Limit: 10, Command: "GRAB"}, wantIDs: []int{}},
+		}
+		for _, tt := range logTests {
+			commandLogs, err := storage.ListCommandLogs(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("ListCommandLogs(%+v): %v", tt.filter, err)
+			}
+			ids := []int{}
+			for _, commandLog := range commandLogs {
+				ids = append(ids, commandLog.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("ListCommandLogs(%+v) ids = %v, want %v", tt.filter, ids, tt.wantIDs)
+			}
+		}
+
+		codeTests := []struct {
+			filter       CommandCodeFilter
+			wantCommands []string
+		}{
+			{filter: CommandCodeFilter{Limit: 10, CommandLogID: 2}, wantCommands: []string{"DOWN", "UP"}},
+			{filter: CommandCodeFilter{Limit: 10, Command: "UP"}, wantCommands: []string{"UP", "UP", "UP"}},
+			{filter: CommandCodeFilter{Limit: 2, Command: "UP", Order: OrderDesc}, wantCommands: []string{"UP", "UP"}},
+			{filter: CommandCodeFilter{Limit: 10, CommandLogID: 3, Command: "UP"}, wantCommands: []string{}},
+		}
+		for _, tt := range codeTests {
+			codes, err := storage.ListCommandCodes(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("ListCommandCodes(%+v): %v", tt.filter, err)
+			}
+			commands := []string{}
+			for i, code := range codes {
+				commands = append(commands, code.Command)
+				if i > 0 && (code.ID > codes[i-1].ID) != (tt.filter.Order != OrderDesc) {
+					t.Errorf("ListCommandCodes(%+v) = %+v, not sorted by id", tt.filter, codes)
+				}
+			}
+			slices.Sort(commands)
+			if !slices.Equal(commands, tt.wantCommands) {
+				t.Errorf("ListCommandCodes(%+v) commands = %v, want %v", tt.filter, commands, tt.wantCommands)
+			}
+		}
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		storage := newStorage(t)
+		for i := 0; i < 3; i++ {
+			commandLog, err := storage.SetCommandLog(ctx, &CommandLog{Commands: []string{"UP", "DOWN"}})
+			if err != nil {
+				t.Fatalf("SetCommandLog: %v", err)
+			}
+			if _, err := storage.SetCommandCodes(ctx, []CommandCode{{Command: "UP", Code: "0"}, {Command: "DOWN", Code: "1"}}, commandLog.ID); err != nil {
+				t.Fatalf("SetCommandCodes: %v", err)
+			}
+		}
+
+		deleted, err := storage.DeleteOldCommandLogs(ctx, RetentionPolicy{MaxLogs: 1})
+		if err != nil || deleted != 2 {
+			t.Fatalf("DeleteOldCommandLogs = %d, %v, want 2", deleted, err)
+		}
+		if _, err := storage.GetCommandLog(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetCommandLog of a deleted log: got %v, want %v", err, sql.ErrNoRows)
+		}
+		// the codes are deleted with their log
+		if codes, err := storage.ListCommandCodes(ctx, CommandCodeFilter{Limit: 10}); err != nil || len(codes) != 2 || codes[0].CommandLogID != 3 {
+			t.Fatalf("ListCommandCodes after the cleanup = %+v, %v, want only the codes of log 3", codes, err)
+		}
+
+		// ids are not reused
+		commandLog, err := storage.SetCommandLog(ctx, &CommandLog{Commands: []string{"UP"}})
+		if err != nil || commandLog.ID != 4 {
+			t.Fatalf("SetCommandLog after the cleanup = %+v, %v, want id 4", commandLog, err)
+		}
+	})
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage { return NewMemoryStorage() })
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrStorageTimeout is returned when a storage operation takes longer than its deadline
+var ErrStorageTimeout = errors.New("storage operation timed out")
+
+// ErrStorageUnavailable is returned when the storage can't be reached
+var ErrStorageUnavailable = errors.New("storage unavailable")
+
+// StorageTimeouts are the deadlines of storage operations, 0 means no deadline
+// (the operation still stops when the request context is canceled)
+type StorageTimeouts struct {
+	Read  time.Duration // Get* methods
+	Write time.Duration // Set* methods
+	Clean time.Duration // DeleteOldCommandLogs
+}
+
+// timeoutStorage wraps a Storage, sets the deadline for every operation
+// and turns timeouts and connection errors into ErrStorageTimeout and ErrStorageUnavailable
+type timeoutStorage struct {
+	storage  Storage
+	timeouts StorageTimeouts
+}
+
+func NewTimeoutStorage(storage Storage, timeouts StorageTimeouts) *timeoutStorage {
+	return &timeoutStorage{
+		storage:  storage,
+		timeouts: timeouts,
+	}
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// storageError adds ErrStorageTimeout or ErrStorageUnavailable to the error, so the API can tell them apart
+func storageError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// the driver doesn't always return context.DeadlineExceeded (e.g. Postgres returns "canceling statement"),
+	// so the context itself is checked
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrStorageTimeout, err)
+	}
+	// the same for a client that went away - it is not a storage error
+	if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("%w: %w", context.Canceled, err)
+	}
+
+	var netErr *net.OpError
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+
+	return err
+}
+
+func (s *timeoutStorage) SetCommandLog(ctx context.Context, commandLog *CommandLog) (*CommandLogRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Write)
+	defer cancel()
+
+	commandLogRequest, err := s.storage.SetCommandLog(ctx, commandLog)
+	return commandLogRequest, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) ListCommandLogs(ctx context.Context, filter CommandLogFilter) ([]*CommandLogRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	commandLogs, err := s.storage.ListCommandLogs(ctx, filter)
+	return commandLogs, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) ListCommandCodes(ctx context.Context, filter CommandCodeFilter) ([]CommandCodeRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	commandCodes, err := s.storage.ListCommandCodes(ctx, filter)
+	return commandCodes, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) CountCommandLogs(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	count, err := s.storage.CountCommandLogs(ctx)
+	return count, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) GetLatestCommandLog(ctx context.Context) (*CommandLogRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	commandLog, err := s.storage.GetLatestCommandLog(ctx)
+	return commandLog, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) GetCommandLog(ctx context.Context, id int) (*CommandLogRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	commandLog, err := s.storage.GetCommandLog(ctx, id)
+	return commandLog, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) GetCommandCodesForCommandLog(ctx context.Context, commandLogID int) ([]CommandCodeRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	commandCodes, err := s.storage.GetCommandCodesForCommandLog(ctx, commandLogID)
+	return commandCodes, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) SetCommandCodes(ctx context.Context, codes []CommandCode, commandLogID int) ([]CommandCodeRequest, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Write)
+	defer cancel()
+
+	commandCodes, err := s.storage.SetCommandCodes(ctx, codes, commandLogID)
+	return commandCodes, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) Ping(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	return storageError(ctx, s.storage.Ping(ctx))
+}
+
+func (s *timeoutStorage) SchemaVersion(ctx context.Context) (int, int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Read)
+	defer cancel()
+
+	version, latest, err := s.storage.SchemaVersion(ctx)
+	return version, latest, storageError(ctx, err)
+}
+
+func (s *timeoutStorage) Close() error {
+	return s.storage.Close()
+}
+
+func (s *timeoutStorage) DeleteOldCommandLogs(ctx context.Context, policy RetentionPolicy) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Clean)
+	defer cancel()
+
+	deleted, err := s.storage.DeleteOldCommandLogs(ctx, policy)
+	return deleted, storageError(ctx, err)
+}
@@ -7,23 +7,64 @@ type CommandCodeRequest struct {
 	CommandLogID int
 	Command      string
 	CommandCode  string
+	// max code length used to generate the code, 0 - no limit
+	MaxCodeLength int
 }
 
 type CommandCode struct {
-	Command string
-	Code    string
+	Command       string
+	Code          string
+	MaxCodeLength int
 }
 
 type CommandLogRequest struct {
 	ID        int
 	Commands  []string  `json:"commands"` //name to show when serialized to json
 	Timestamp time.Time `json:"timestamp"`
+	// optional limit of the code length for this log, 0 - server default
+	MaxCodeLength int `json:"maxCodeLength,omitempty"`
 }
 
 type CommandLog struct {
-	Commands []string `json:"commands"` //name to show when serialized to json
+	Commands      []string `json:"commands"` //name to show when serialized to json
+	MaxCodeLength int      `json:"maxCodeLength,omitempty"`
 }
 
 type CommandCodeOnly struct {
 	CommandCode string `json:"rcr"`
 }
+
+type CodesFromFrequenciesRequest struct {
+	// counts or probabilities of the commands, {key="command", value=weight}
+	Frequencies   map[string]float64 `json:"frequencies"`
+	MaxCodeLength int                `json:"maxCodeLength,omitempty"` // 0 - server default
+}
+
+type CodesFromFrequenciesResponse struct {
+	Codes         map[string]string `json:"codes"`                   // {key="command", value="code"}
+	MaxCodeLength int               `json:"maxCodeLength,omitempty"` // limit used, 0 - no limit
+}
+
+type EncodeRequest struct {
+	CommandLogID int      `json:"commandLogId"` // log which codebook to use, 0 - the latest log
+	Commands     []string `json:"commands"`
+}
+
+type EncodeResponse struct {
+	CommandLogID int    `json:"commandLogId"` // log which codebook was used
+	Data         string `json:"data"`         // packed bits, base64
+	BitLength    int    `json:"bitLength"`
+	Bits         string `json:"bits"` // the same bits as "0101" string, for debugging
+}
+
+type DecodeRequest struct {
+	CommandLogID int    `json:"commandLogId"` // log which codebook to use, 0 - the latest log
+	Data         string `json:"data"`         // packed bits, base64
+	BitLength    int    `json:"bitLength"`
+	Method       string `json:"method"` // "table" (default) or "tree"
+}
+
+type DecodeResponse struct {
+	CommandLogID int      `json:"commandLogId"`
+	Commands     []string `json:"commands"`
+}
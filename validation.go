@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"command-encoding-service/pkg/generate_codes"
+)
+
+// Limits for the request bodies
+const (
+	MaxRequestBodySize = 1 << 20 // 1 MiB
+	MaxCommandsInLog   = 10000
+	MaxCommandLength   = 64
+)
+
+// commands are used in URLs (/rcr/{command}), so only URL-safe characters are allowed
+var commandPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// FieldError describes what is wrong with one field of the request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// decodeJSONBody decodes the request body into v,
+// the body must be one JSON object without unknown fields and not larger than MaxRequestBodySize
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return newAPIError(http.StatusRequestEntityTooLarge, CodeRequestTooLarge,
+				fmt.Sprintf("request body larger than %d bytes", maxBytesErr.Limit), err)
+		}
+		return NewBadRequestError(CodeInvalidJSON, err)
+	}
+
+	if decoder.More() {
+		return NewBadRequestError(CodeInvalidJSON, errors.New("request body must contain a single JSON object"))
+	}
+
+	return nil
+}
+
+// validateCommands checks the list of commands, field is the name of the list in the request
+func validateCommands(field string, commands []string) []FieldError {
+	var fieldErrors []FieldError
+
+	if len(commands) == 0 {
+		return append(fieldErrors, FieldError{Field: field, Message: "must be a non-empty list of commands"})
+	}
+	if len(commands) > MaxCommandsInLog {
+		return append(fieldErrors, FieldError{Field: field, Message: fmt.Sprintf("must not contain more than %d commands", MaxCommandsInLog)})
+	}
+
+	for i, cmd := range commands {
+		if message := validateCommand(cmd); message != "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Message: message})
+		}
+	}
+
+	return fieldErrors
+}
+
+// validateCommand returns the message for an invalid command, "" for a valid one
+func validateCommand(cmd string) string {
+	switch {
+	case cmd == "":
+		return "must not be empty"
+	case len(cmd) > MaxCommandLength:
+		return fmt.Sprintf("must not be longer than %d characters", MaxCommandLength)
+	case !commandPattern.MatchString(cmd):
+		return "may contain only letters, digits, '_', '-' and '.'"
+	}
+	return ""
+}
+
+// validateCommandLog checks the body of POST /commands
+func validateCommandLog(commandLog *CommandLog) error {
+	fieldErrors := validateCommands("commands", commandLog.Commands)
+
+	// the number of distinct commands is known only for a valid list,
+	// the limit is checked so a log that can't get codes is not stored
+	if commandLog.MaxCodeLength < 0 || len(fieldErrors) == 0 {
+		if err := generate_codes.CheckMaxCodeLength(countDistinctCommands(commandLog.Commands), commandLog.MaxCodeLength); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: "maxCodeLength", Message: err.Error()})
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return NewFieldValidationError(fieldErrors)
+	}
+	return nil
+}
+
+// validateCodesFromFrequencies checks the body of POST /codes/from-frequencies
+func validateCodesFromFrequencies(request *CodesFromFrequenciesRequest) error {
+	var fieldErrors []FieldError
+
+	switch {
+	case len(request.Frequencies) == 0:
+		fieldErrors = append(fieldErrors, FieldError{Field: "frequencies", Message: "must be a non-empty object of command frequencies"})
+	case len(request.Frequencies) > MaxCommandsInLog:
+		fieldErrors = append(fieldErrors, FieldError{Field: "frequencies", Message: fmt.Sprintf("must not contain more than %d commands", MaxCommandsInLog)})
+	default:
+		// sorted, so the errors are always in the same order
+		commands := make([]string, 0, len(request.Frequencies))
+		for cmd := range request.Frequencies {
+			commands = append(commands, cmd)
+		}
+		sort.Strings(commands)
+
+		for _, cmd := range commands {
+			field := fmt.Sprintf("frequencies[%q]", cmd)
+			if message := validateCommand(cmd); message != "" {
+				fieldErrors = append(fieldErrors, FieldError{Field: field, Message: message})
+			}
+			if request.Frequencies[cmd] < 0 {
+				fieldErrors = append(fieldErrors, FieldError{Field: field, Message: "must not be negative"})
+			}
+		}
+	}
+
+	if request.MaxCodeLength < 0 || len(fieldErrors) == 0 {
+		if err := generate_codes.CheckMaxCodeLength(len(request.Frequencies), request.MaxCodeLength); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: "maxCodeLength", Message: err.Error()})
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return NewFieldValidationError(fieldErrors)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPostCommandsValidation(t *testing.T) {
+	tooManyCommands := fmt.Sprintf(`{"commands": [%s]}`, strings.TrimSuffix(strings.Repeat(`"UP",`, MaxCommandsInLog+1), ","))
+	tooLarge := fmt.Sprintf(`{"commands": ["%s"]}`, strings.Repeat("A", MaxRequestBodySize))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantFields []string
+	}{
+		{name: "empty body", body: "", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "syntax error", body: `{"commands": [`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "wrong type", body: `{"commands": "UP"}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "unknown field", body: `{"commands": ["UP"], "command": "UP"}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "two objects", body: `{"commands": ["UP"]} {}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "too large", body: tooLarge, wantStatus: http.StatusRequestEntityTooLarge, wantCode: CodeRequestTooLarge},
+		{name: "no commands", body: `{}`, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed, wantFields: []string{"commands"}},
+		{name: "empty list", body: `{"commands": []}`, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed, wantFields: []string{"commands"}},
+		{name: "too many commands", body: tooManyCommands, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed, wantFields: []string{"commands"}},
+		{
+			name:       "invalid commands",
+			body:       fmt.Sprintf(`{"commands": ["UP", "", "a/b", "%s", "DOWN"]}`, strings.Repeat("A", MaxCommandLength+1)),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   CodeValidationFailed,
+			wantFields: []string{"commands[1]", "commands[2]", "commands[3]"},
+		},
+		{
+			// the max code length is checked only when the commands are valid
+			name:       "invalid commands and max code length",
+			body:       `{"commands": ["UP", "a b"], "maxCodeLength": -1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   CodeValidationFailed,
+			wantFields: []string{"commands[1]", "maxCodeLength"},
+		},
+		{
+			name:       "max code length too small",
+			body:       `{"commands": ["UP", "DOWN", "LEFT"], "maxCodeLength": 1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   CodeValidationFailed,
+			wantFields: []string{"maxCodeLength"},
+		},
+		{
+			name:       "max code length too large",
+			body:       `{"commands": ["UP"], "maxCodeLength": 65}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   CodeValidationFailed,
+			wantFields: []string{"maxCodeLength"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, storage := newTestServer(t)
+
+			apiErr := decodeResponse[APIError](t, doRequest(t, handler, "POST", "/commands", tt.body), tt.wantStatus)
+			if apiErr.Code != tt.wantCode {
+				t.Fatalf("code %q, want %q", apiErr.Code, tt.wantCode)
+			}
+			var fields []string
+			for _, fieldErr := range apiErr.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Fatalf("field errors %+v, want fields %v", apiErr.Errors, tt.wantFields)
+			}
+
+			if count, _ := storage.CountCommandLogs(context.Background()); count != 0 {
+				t.Fatalf("an invalid command log was stored")
+			}
+		})
+	}
+}
+
+func TestPostCommandsAcceptsValidLogs(t *testing.T) {
+	tests := []string{
+		`{"commands": ["UP"]}`,
+		`{"commands": ["move_left", "move-right", "v1.2", "A9"]}`,
+		// two commands fit into 1-bit codes
+		`{"commands": ["UP", "DOWN", "UP"], "maxCodeLength": 1}`,
+		fmt.Sprintf(`{"commands": ["%s"]}`, strings.Repeat("A", MaxCommandLength)),
+	}
+
+	for _, body := range tests {
+		handler, _ := newTestServer(t)
+		if recorder := doRequest(t, handler, "POST", "/commands", body); recorder.Code != http.StatusOK {
+			t.Errorf("POST /commands %s: status %d, body %s", body, recorder.Code, recorder.Body)
+		}
+	}
+}